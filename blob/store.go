@@ -0,0 +1,85 @@
+package blob
+
+import (
+	"errors"
+	"guidance/config"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned by Get when the key does not exist.
+var ErrNotFound = errors.New("blob: not found")
+
+// Store persists opaque blobs such as ticket attachments under string keys.
+type Store interface {
+	Put(key string, r io.Reader) (int64, error)
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// LocalStore keeps blobs as files under Dir. It is intended for development
+// and single node deployments.
+type LocalStore struct {
+	Dir string
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if strings.Contains(key, "..") || clean == "/" {
+		return "", errors.New("blob: invalid key")
+	}
+	return filepath.Join(s.Dir, clean), nil
+}
+
+func (s *LocalStore) Put(key string, r io.Reader) (int64, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(p)
+	}
+	return n, err
+}
+
+func (s *LocalStore) Get(key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStore) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// NewStore returns the configured store. Only the local directory store is
+// supported today.
+func NewStore(cfg config.Blob) Store {
+	return &LocalStore{Dir: cfg.Dir}
+}
@@ -0,0 +1,176 @@
+package chat
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	maxMessage = 8 << 10
+)
+
+// Inbound is a frame sent by a client.
+type Inbound struct {
+	Type string `json:"type"`
+	Body string `json:"body"`
+}
+
+// Client is one open WebSocket belonging to a participant of a room.
+type Client struct {
+	Role    string
+	conn    *websocket.Conn
+	send    chan []byte
+	allowed func() bool
+}
+
+// NewClient wraps conn. allowed is asked before every broadcast to the
+// client; once it returns false the client is disconnected, so access ends
+// as soon as the participant no longer belongs to the room.
+func NewClient(conn *websocket.Conn, role string, allowed func() bool) *Client {
+	return &Client{Role: role, conn: conn, send: make(chan []byte, 32), allowed: allowed}
+}
+
+// Send queues v as a JSON frame. A client that cannot keep up is dropped
+// rather than blocking the sender.
+func (c *Client) Send(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	select {
+	case c.send <- b:
+	default:
+		c.conn.Close()
+	}
+}
+
+// Run pumps frames in both directions until the connection closes, calling
+// handle for every inbound frame on the caller's goroutine.
+func (c *Client) Run(handle func(Inbound)) {
+	done := make(chan struct{})
+	go c.writePump(done)
+	defer close(done)
+
+	c.conn.SetReadLimit(maxMessage)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		var in Inbound
+		if err := c.conn.ReadJSON(&in); err != nil {
+			return
+		}
+		handle(in)
+	}
+}
+
+func (c *Client) writePump(done chan struct{}) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case <-done:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+		case b := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, b); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Hub tracks the open connections of every conversation. A conversation is
+// identified by the student's id, since each student has one mentor at a
+// time. Presence is per process, so with several replicas a participant is
+// only seen as online by peers connected to the same one.
+type Hub struct {
+	mu    sync.RWMutex
+	rooms map[uint]map[*Client]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{rooms: map[uint]map[*Client]struct{}{}}
+}
+
+func (h *Hub) Join(room uint, c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rooms[room] == nil {
+		h.rooms[room] = map[*Client]struct{}{}
+	}
+	h.rooms[room][c] = struct{}{}
+}
+
+func (h *Hub) Leave(room uint, c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.rooms[room], c)
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+}
+
+// Broadcast sends v to every connection in the room that is still allowed
+// in it, and disconnects the ones that are not.
+func (h *Hub) Broadcast(room uint, v interface{}) {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.rooms[room]))
+	for c := range h.rooms[room] {
+		clients = append(clients, c)
+	}
+	h.mu.RUnlock()
+	for _, c := range clients {
+		if c.allowed != nil && !c.allowed() {
+			h.Leave(room, c)
+			msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "no longer part of this conversation")
+			c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+			c.conn.Close()
+			continue
+		}
+		c.Send(v)
+	}
+}
+
+// Close disconnects every client with a "going away" close frame, so they
+// reconnect to another replica.
+func (h *Hub) Close() {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for _, clients := range h.rooms {
+		for c := range clients {
+			c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+			c.conn.Close()
+		}
+	}
+}
+
+// Online reports whether anyone with role has a connection open in room.
+func (h *Hub) Online(room uint, role string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.rooms[room] {
+		if c.Role == role {
+			return true
+		}
+	}
+	return false
+}
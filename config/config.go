@@ -0,0 +1,207 @@
+// Package config holds every setting the server reads at startup. Values
+// come from, in increasing order of precedence: the defaults below, a YAML
+// file, a .env file and the process environment. Any environment variable
+// can instead be given as NAME_FILE pointing at a file holding the value,
+// which is how Docker and Kubernetes secrets are mounted.
+package config
+
+import "time"
+
+type Config struct {
+	Server    Server    `yaml:"server"`
+	Logging   Logging   `yaml:"logging"`
+	Database  Database  `yaml:"database"`
+	Razorpay  Razorpay  `yaml:"razorpay"`
+	CORS      CORS      `yaml:"cors"`
+	Auth      Auth      `yaml:"auth"`
+	Mail      Mail      `yaml:"mail"`
+	Messaging Messaging `yaml:"messaging"`
+	Jobs      Jobs      `yaml:"jobs"`
+	Tickets   Tickets   `yaml:"tickets"`
+	Ratings   Ratings   `yaml:"ratings"`
+	Blob      Blob      `yaml:"blob"`
+	Metrics   Metrics   `yaml:"metrics"`
+	Tracing   Tracing   `yaml:"tracing"`
+}
+
+type Server struct {
+	Addr              string        `yaml:"addr" env:"HTTP_ADDR"`
+	ReadTimeout       time.Duration `yaml:"readTimeout" env:"HTTP_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	// WriteTimeout is off by default because the event stream and chat
+	// sockets stay open for as long as the client is connected.
+	WriteTimeout time.Duration `yaml:"writeTimeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout  time.Duration `yaml:"idleTimeout" env:"HTTP_IDLE_TIMEOUT"`
+	// ShutdownTimeout is how long in-flight requests get to finish after
+	// SIGTERM before they are cut off.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+	// TrustedProxies are the load balancers allowed to set X-Forwarded-For.
+	TrustedProxies []string `yaml:"trustedProxies" env:"TRUSTED_PROXIES"`
+	// FrontendURL is the dashboard's base URL, used for links and redirects.
+	FrontendURL string `yaml:"frontendUrl" env:"FRONTEND_URL"`
+}
+
+type Logging struct {
+	// Format is "text" or "json".
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+	// Level is "debug", "info", "warn" or "error".
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+}
+
+type Database struct {
+	Host            string        `yaml:"host" env:"DB_HOST"`
+	Port            int           `yaml:"port" env:"DB_PORT"`
+	User            string        `yaml:"user" env:"DB_USER"`
+	Password        string        `yaml:"password" env:"DB_PASSWORD"`
+	Name            string        `yaml:"name" env:"DB_NAME"`
+	SSLMode         string        `yaml:"sslMode" env:"DB_SSLMODE"`
+	MaxOpenConns    int           `yaml:"maxOpenConns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"maxIdleConns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnectRetries  int           `yaml:"connectRetries" env:"DB_CONNECT_RETRIES"`
+}
+
+type Razorpay struct {
+	KeyID     string `yaml:"keyId" env:"RAZORPAY_KEY_ID"`
+	KeySecret string `yaml:"keySecret" env:"RAZORPAY_KEY_SECRET"`
+	// WebhookSecret is the secret set on the payment.captured webhook in the
+	// Razorpay dashboard, used to check X-Razorpay-Signature on /order.
+	WebhookSecret string `yaml:"webhookSecret" env:"RAZORPAY_WEBHOOK_SECRET"`
+	// RedirectURL is where the browser goes after a verified payment; the
+	// payment id is appended as ?reference=. Defaults to FrontendURL/razor.
+	RedirectURL string `yaml:"redirectUrl" env:"RAZORPAY_REDIRECT_URL"`
+}
+
+type CORS struct {
+	AllowedOrigins []string `yaml:"allowedOrigins" env:"CORS_ALLOWED_ORIGINS"`
+	// AllowedHeaders are allowed on top of Content-Type and Authorization.
+	AllowedHeaders   []string      `yaml:"allowedHeaders" env:"CORS_ALLOWED_HEADERS"`
+	AllowCredentials bool          `yaml:"allowCredentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"maxAge" env:"CORS_MAX_AGE"`
+}
+
+type Auth struct {
+	// PasswordResetURL is the page that accepts reset tokens. Defaults to
+	// FrontendURL/reset-password.
+	PasswordResetURL string `yaml:"passwordResetUrl" env:"PASSWORD_RESET_URL"`
+	TOTPIssuer       string `yaml:"totpIssuer" env:"TOTP_ISSUER"`
+	RequireOwner2FA  bool   `yaml:"requireOwner2fa" env:"OWNER_REQUIRE_2FA"`
+}
+
+type Mail struct {
+	// Transport is "smtp", "file" or "memory".
+	Transport    string `yaml:"transport" env:"MAIL_TRANSPORT"`
+	From         string `yaml:"from" env:"MAIL_FROM"`
+	SMTPHost     string `yaml:"smtpHost" env:"SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtpPort" env:"SMTP_PORT"`
+	SMTPUser     string `yaml:"smtpUser" env:"SMTP_USER"`
+	SMTPPassword string `yaml:"smtpPassword" env:"SMTP_PASSWORD"`
+	FileDir      string `yaml:"fileDir" env:"MAIL_FILE_DIR"`
+}
+
+type Messaging struct {
+	// Provider is "whatsapp", "twilio" or "fake".
+	Provider              string `yaml:"provider" env:"MESSAGING_PROVIDER"`
+	WhatsAppPhoneNumberID string `yaml:"whatsappPhoneNumberId" env:"WHATSAPP_PHONE_NUMBER_ID"`
+	WhatsAppToken         string `yaml:"whatsappToken" env:"WHATSAPP_TOKEN"`
+	TwilioAccountSID      string `yaml:"twilioAccountSid" env:"TWILIO_ACCOUNT_SID"`
+	TwilioAuthToken       string `yaml:"twilioAuthToken" env:"TWILIO_AUTH_TOKEN"`
+	TwilioFrom            string `yaml:"twilioFrom" env:"TWILIO_FROM"`
+}
+
+type Jobs struct {
+	RenewalSchedule     string `yaml:"renewalSchedule" env:"RENEWAL_JOB_SCHEDULE"`
+	RenewalReminderDays int    `yaml:"renewalReminderDays" env:"RENEWAL_REMINDER_DAYS"`
+	RenewalPaymentLink  string `yaml:"renewalPaymentLink" env:"RENEWAL_PAYMENT_LINK"`
+}
+
+type Tickets struct {
+	SLAHours int `yaml:"slaHours" env:"TICKET_SLA_HOURS"`
+}
+
+type Ratings struct {
+	AlertThreshold float64 `yaml:"alertThreshold" env:"RATING_ALERT_THRESHOLD"`
+}
+
+type Blob struct {
+	Dir string `yaml:"dir" env:"BLOB_DIR"`
+}
+
+type Metrics struct {
+	// Token must be sent by the scraper as a bearer token. /metrics is
+	// disabled while it is empty.
+	Token string `yaml:"token" env:"METRICS_TOKEN"`
+}
+
+// Tracing uses the standard OpenTelemetry variable names so the usual
+// collector setups work unchanged.
+type Tracing struct {
+	// Exporter is "none", which records nothing, or "otlp".
+	Exporter string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER"`
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://otel-collector:4318.
+	// Empty means the exporter's default of http://localhost:4318.
+	Endpoint    string  `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	ServiceName string  `yaml:"serviceName" env:"OTEL_SERVICE_NAME"`
+	SampleRatio float64 `yaml:"sampleRatio" env:"OTEL_TRACES_SAMPLER_ARG"`
+}
+
+// Default returns the settings used when nothing overrides them. They suit
+// local development; production must at least set the database and
+// Razorpay credentials.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":8080",
+			ReadTimeout:       time.Minute,
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+			FrontendURL:       "http://localhost:3000",
+		},
+		Logging: Logging{
+			Format: "text",
+			Level:  "info",
+		},
+		Database: Database{
+			Port:            5432,
+			MaxOpenConns:    100,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: time.Hour,
+			ConnectRetries:  5,
+		},
+		CORS: CORS{
+			AllowedOrigins:   []string{"http://localhost:3000"},
+			AllowCredentials: true,
+			MaxAge:           12 * time.Hour,
+		},
+		Auth: Auth{
+			TOTPIssuer: "JEE Simplified",
+		},
+		Mail: Mail{
+			Transport: "file",
+			SMTPPort:  587,
+			FileDir:   "tmp/mail",
+		},
+		Messaging: Messaging{
+			Provider: "fake",
+		},
+		Jobs: Jobs{
+			RenewalSchedule:     "0 9 * * *",
+			RenewalReminderDays: 3,
+		},
+		Tickets: Tickets{
+			SLAHours: 24,
+		},
+		Ratings: Ratings{
+			AlertThreshold: 3,
+		},
+		Blob: Blob{
+			Dir: "tmp/blobs",
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			ServiceName: "guidance",
+			SampleRatio: 1,
+		},
+	}
+}
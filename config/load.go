@@ -0,0 +1,323 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Load reads the configuration and validates it. The YAML file is
+// CONFIG_FILE, or config.yaml when that exists; the .env file is optional.
+func Load() (Config, error) {
+	cfg := Default()
+
+	// .env only fills variables that are not already set, so the real
+	// environment still wins over it
+	if _, err := os.Stat(".env"); err == nil {
+		if err := godotenv.Load(); err != nil {
+			return cfg, fmt.Errorf("config: reading .env: %w", err)
+		}
+	}
+
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		if _, err := os.Stat("config.yaml"); err == nil {
+			path = "config.yaml"
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("config: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("config: parsing %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return cfg, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	frontend := strings.TrimRight(cfg.Server.FrontendURL, "/")
+	if cfg.Razorpay.RedirectURL == "" {
+		cfg.Razorpay.RedirectURL = frontend + "/razor"
+	}
+	if cfg.Auth.PasswordResetURL == "" {
+		cfg.Auth.PasswordResetURL = frontend + "/reset-password"
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// lookup returns the variable's value, reading it from NAME_FILE if that is
+// set instead. An empty variable counts as unset, as compose passes one for
+// every ${NAME} the shell does not define.
+func lookup(name string) (string, bool, error) {
+	value := os.Getenv(name)
+	hasValue := value != ""
+	path, hasFile := os.LookupEnv(name + "_FILE")
+	switch {
+	case hasValue && hasFile:
+		return "", false, fmt.Errorf("%s: set either %s or %s_FILE, not both", name, name, name)
+	case hasFile:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+	return value, hasValue, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv overrides every field that has an env tag and a value in the
+// environment.
+func applyEnv(v reflect.Value) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		name := v.Type().Field(i).Tag.Get("env")
+		if name == "" {
+			if field.Kind() == reflect.Struct {
+				if err := applyEnv(field); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			continue
+		}
+		value, ok, err := lookup(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := set(field, strings.TrimSpace(value)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func set(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		// Plain numbers are seconds
+		if n, err := strconv.Atoi(value); err == nil {
+			field.SetInt(int64(time.Duration(n) * time.Second))
+			return nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s or 2h", value)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetFloat(f)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// Validate reports every problem at once, naming the environment variable
+// to fix.
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	required := func(name, value string) {
+		if strings.TrimSpace(value) == "" {
+			fail("%s is required", name)
+		}
+	}
+	absoluteURL := func(name, value string) {
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("%s must be an http(s) URL, got %q", name, value)
+		}
+	}
+	positive := func(name string, value int) {
+		if value <= 0 {
+			fail("%s must be greater than 0, got %d", name, value)
+		}
+	}
+
+	required("HTTP_ADDR", c.Server.Addr)
+	for name, d := range map[string]time.Duration{
+		"HTTP_READ_TIMEOUT":        c.Server.ReadTimeout,
+		"HTTP_READ_HEADER_TIMEOUT": c.Server.ReadHeaderTimeout,
+		"HTTP_WRITE_TIMEOUT":       c.Server.WriteTimeout,
+		"HTTP_IDLE_TIMEOUT":        c.Server.IdleTimeout,
+	} {
+		if d < 0 {
+			fail("%s must not be negative", name)
+		}
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		fail("SHUTDOWN_TIMEOUT must be greater than 0")
+	}
+	absoluteURL("FRONTEND_URL", c.Server.FrontendURL)
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				fail("TRUSTED_PROXIES: %q is not an IP address or CIDR range", proxy)
+			}
+		}
+	}
+
+	switch c.Logging.Format {
+	case "text", "json":
+	default:
+		fail("LOG_FORMAT must be text or json, got %q", c.Logging.Format)
+	}
+	switch strings.ToLower(c.Logging.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("LOG_LEVEL must be debug, info, warn or error, got %q", c.Logging.Level)
+	}
+
+	required("DB_HOST", c.Database.Host)
+	required("DB_USER", c.Database.User)
+	required("DB_NAME", c.Database.Name)
+	if c.Database.Port <= 0 || c.Database.Port > 65535 {
+		fail("DB_PORT must be a port number, got %d", c.Database.Port)
+	}
+	switch c.Database.SSLMode {
+	case "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		fail("DB_SSLMODE %q is not a PostgreSQL sslmode", c.Database.SSLMode)
+	}
+	positive("DB_MAX_OPEN_CONNS", c.Database.MaxOpenConns)
+	if c.Database.MaxIdleConns < 0 {
+		fail("DB_MAX_IDLE_CONNS must not be negative")
+	}
+	positive("DB_CONNECT_RETRIES", c.Database.ConnectRetries)
+
+	required("RAZORPAY_KEY_ID", c.Razorpay.KeyID)
+	required("RAZORPAY_KEY_SECRET", c.Razorpay.KeySecret)
+	required("RAZORPAY_WEBHOOK_SECRET", c.Razorpay.WebhookSecret)
+	absoluteURL("RAZORPAY_REDIRECT_URL", c.Razorpay.RedirectURL)
+
+	if len(c.CORS.AllowedOrigins) == 0 {
+		fail("CORS_ALLOWED_ORIGINS needs at least one origin")
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(strings.Replace(origin, "://*.", "://", 1)); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			fail("CORS_ALLOWED_ORIGINS: %q is not an origin such as https://admin.example.com", origin)
+		}
+	}
+
+	absoluteURL("PASSWORD_RESET_URL", c.Auth.PasswordResetURL)
+	required("TOTP_ISSUER", c.Auth.TOTPIssuer)
+
+	switch c.Mail.Transport {
+	case "smtp":
+		required("SMTP_HOST", c.Mail.SMTPHost)
+		required("MAIL_FROM", c.Mail.From)
+		positive("SMTP_PORT", c.Mail.SMTPPort)
+	case "file":
+		required("MAIL_FILE_DIR", c.Mail.FileDir)
+	case "memory":
+	default:
+		fail("MAIL_TRANSPORT must be smtp, file or memory, got %q", c.Mail.Transport)
+	}
+
+	switch c.Messaging.Provider {
+	case "whatsapp":
+		required("WHATSAPP_PHONE_NUMBER_ID", c.Messaging.WhatsAppPhoneNumberID)
+		required("WHATSAPP_TOKEN", c.Messaging.WhatsAppToken)
+	case "twilio":
+		required("TWILIO_ACCOUNT_SID", c.Messaging.TwilioAccountSID)
+		required("TWILIO_AUTH_TOKEN", c.Messaging.TwilioAuthToken)
+		required("TWILIO_FROM", c.Messaging.TwilioFrom)
+	case "fake":
+	default:
+		fail("MESSAGING_PROVIDER must be whatsapp, twilio or fake, got %q", c.Messaging.Provider)
+	}
+
+	required("RENEWAL_JOB_SCHEDULE", c.Jobs.RenewalSchedule)
+	positive("RENEWAL_REMINDER_DAYS", c.Jobs.RenewalReminderDays)
+	if c.Jobs.RenewalPaymentLink != "" {
+		absoluteURL("RENEWAL_PAYMENT_LINK", c.Jobs.RenewalPaymentLink)
+	}
+	positive("TICKET_SLA_HOURS", c.Tickets.SLAHours)
+	if c.Ratings.AlertThreshold < 1 || c.Ratings.AlertThreshold > 5 {
+		fail("RATING_ALERT_THRESHOLD must be between 1 and 5, got %g", c.Ratings.AlertThreshold)
+	}
+	required("BLOB_DIR", c.Blob.Dir)
+
+	switch c.Tracing.Exporter {
+	case "none":
+	case "otlp":
+		if c.Tracing.Endpoint != "" {
+			absoluteURL("OTEL_EXPORTER_OTLP_ENDPOINT", c.Tracing.Endpoint)
+		}
+		required("OTEL_SERVICE_NAME", c.Tracing.ServiceName)
+	default:
+		fail("OTEL_TRACES_EXPORTER must be none or otlp, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("OTEL_TRACES_SAMPLER_ARG must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+
+	return errors.Join(errs...)
+}
+
+// DSN is the PostgreSQL connection string for the database settings.
+func (d Database) DSN() string {
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d", d.Host, d.User, quote(d.Password), d.Name, d.Port)
+	if d.SSLMode != "" {
+		dsn += " sslmode=" + d.SSLMode
+	}
+	return dsn
+}
+
+// quote escapes a value for a key=value connection string.
+func quote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"guidance/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// newToken returns 32 random bytes, hex encoded.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueSession creates a login session for the account and returns the
+// bearer token to hand to the client.
+func issueSession(c *gin.Context, kind string, principalID uint, ttl time.Duration) (string, time.Time, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	session := models.LoginSession{
+		Kind:        kind,
+		PrincipalID: principalID,
+		TokenHash:   hashToken(token),
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+	if err := dbFor(c).Create(&session).Error; err != nil {
+		return "", time.Time{}, err
+	}
+	return token, session.ExpiresAt, nil
+}
+
+// revokeSessions signs the account out everywhere, including half finished
+// logins such as "owner-mfa".
+func revokeSessions(c *gin.Context, kind string, principalID uint) error {
+	return dbFor(c).Where("(kind = ? OR kind LIKE ?) AND principal_id = ?", kind, kind+"-%", principalID).Delete(&models.LoginSession{}).Error
+}
+
+// bearerToken reads the Authorization header. Browsers cannot set headers
+// on a WebSocket handshake or an EventSource request, so those may pass
+// ?access_token instead.
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	if websocket.IsWebSocketUpgrade(c.Request) || strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		return c.Query("access_token")
+	}
+	return ""
+}
+
+// requireSession rejects requests without a live session of one of the given
+// kinds and stores the account id under "principalID" for the handlers.
+func requireSession(kinds ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c)
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+			return
+		}
+		var session models.LoginSession
+		if err := dbFor(c).Where("token_hash = ? AND kind IN ?", hashToken(token), kinds).First(&session).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+			return
+		}
+		if time.Now().After(session.ExpiresAt) {
+			dbFor(c).Delete(&session)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session expired, please log in again"})
+			return
+		}
+		c.Set("principalID", session.PrincipalID)
+		c.Set("sessionID", session.ID)
+		c.Set("sessionKind", session.Kind)
+		c.Next()
+	}
+}
+
+// hasOwnerSession reports whether the request carries a live owner session,
+// for public routes that allow owners to do more than anonymous callers.
+func hasOwnerSession(c *gin.Context) bool {
+	token := bearerToken(c)
+	if token == "" {
+		return false
+	}
+	var count int64
+	dbFor(c).Model(&models.LoginSession{}).
+		Where("token_hash = ? AND kind = ? AND expires_at > ?", hashToken(token), "owner", time.Now()).
+		Count(&count)
+	return count > 0
+}
+
+// RequireStudent guards the student self-service routes.
+func RequireStudent() gin.HandlerFunc {
+	return requireSession("student")
+}
+
+// RequireAnySession lets through students, mentors and owners alike, for
+// routes whose handler checks access itself from sessionKind.
+func RequireAnySession() gin.HandlerFunc {
+	return requireSession("student", "mentor", "owner")
+}
+
+// Logout ends the session the request was made with.
+func Logout(c *gin.Context) {
+	if err := dbFor(c).Delete(&models.LoginSession{}, c.GetUint("sessionID")).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"guidance/chat"
+	"guidance/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const maxChatMessage = 4000
+
+var chatHub = chat.NewHub()
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     checkOrigin,
+}
+
+// originAllowed decides which cross-origin pages may open a chat socket.
+var originAllowed = func(string) bool { return false }
+
+// SetOriginCheck sets the origin allowlist for chat sockets, normally the
+// same one the CORS middleware uses. Until it is called only same-host
+// pages and non-browser clients can connect.
+func SetOriginCheck(allowed func(origin string) bool) {
+	originAllowed = allowed
+}
+
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return originAllowed(origin)
+}
+
+// chatPair is a student and the mentor they are currently assigned to, seen
+// from one side of the conversation.
+type chatPair struct {
+	student UserSchema
+	mentor  MentorSchema
+	role    string
+}
+
+func (p chatPair) peer() string {
+	if p.role == "student" {
+		return "mentor"
+	}
+	return "student"
+}
+
+// linked reports whether the student is still assigned to the mentor.
+func (p chatPair) linked() bool {
+	var student UserSchema
+	if err := db3.First(&student, p.student.ID).Error; err != nil {
+		return false
+	}
+	return student.Mentor == p.mentor.Name && !student.Expired
+}
+
+func studentChatPair(c *gin.Context) (chatPair, bool) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return chatPair{}, false
+	}
+	if student.Mentor == "" || student.Expired {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "No mentor has been assigned yet"})
+		return chatPair{}, false
+	}
+	var ment MentorSchema
+	if err := dbFor(c).Where("name = ?", student.Mentor).First(&ment).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to find assigned mentor"})
+		return chatPair{}, false
+	}
+	return chatPair{student: student, mentor: ment, role: "student"}, true
+}
+
+func mentorChatPair(c *gin.Context) (chatPair, bool) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return chatPair{}, false
+	}
+	id, ok := paramID(c, "id", "student")
+	if !ok {
+		return chatPair{}, false
+	}
+	student, ok := assignedStudent(c, ment, id)
+	if !ok {
+		return chatPair{}, false
+	}
+	return chatPair{student: student, mentor: ment, role: "mentor"}, true
+}
+
+// markRead stamps every unread message sent by the other side.
+func markRead(c *gin.Context, pair chatPair) (time.Time, error) {
+	now := time.Now()
+	err := dbFor(c).Model(&models.ChatMessage{}).
+		Where("student_id = ? AND mentor_id = ? AND sender = ? AND read_at IS NULL", pair.student.ID, pair.mentor.ID, pair.peer()).
+		Update("read_at", now).Error
+	return now, err
+}
+
+func unreadCount(c *gin.Context, pair chatPair) (int64, error) {
+	var count int64
+	err := dbFor(c).Model(&models.ChatMessage{}).
+		Where("student_id = ? AND mentor_id = ? AND sender = ? AND read_at IS NULL", pair.student.ID, pair.mentor.ID, pair.peer()).
+		Count(&count).Error
+	return count, err
+}
+
+// serveChat upgrades the request and relays messages for the pair until the
+// socket closes. Frames are {"type":"message","body":"..."} to send and
+// {"type":"read"} to mark the peer's messages read.
+func serveChat(c *gin.Context, pair chatPair) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	room := pair.student.ID
+	client := chat.NewClient(conn, pair.role, pair.linked)
+
+	chatHub.Join(room, client)
+	chatHub.Broadcast(room, gin.H{"type": "presence", "role": pair.role, "online": true})
+	client.Send(gin.H{"type": "presence", "role": pair.peer(), "online": chatHub.Online(room, pair.peer())})
+	if unread, err := unreadCount(c, pair); err == nil {
+		client.Send(gin.H{"type": "unread", "count": unread})
+	}
+
+	client.Run(func(in chat.Inbound) {
+		switch in.Type {
+		case "message":
+			body := strings.TrimSpace(in.Body)
+			if body == "" || len(body) > maxChatMessage {
+				client.Send(gin.H{"type": "error", "error": "message must be between 1 and 4000 characters"})
+				return
+			}
+			if !pair.linked() {
+				client.Send(gin.H{"type": "error", "error": "Student is no longer assigned to this mentor"})
+				return
+			}
+			msg := models.ChatMessage{StudentID: pair.student.ID, MentorID: pair.mentor.ID, Sender: pair.role, Body: body}
+			if err := dbFor(c).Create(&msg).Error; err != nil {
+				client.Send(gin.H{"type": "error", "error": "Failed to save message"})
+				return
+			}
+			chatHub.Broadcast(room, gin.H{"type": "message", "message": msg})
+		case "read":
+			if !pair.linked() {
+				client.Send(gin.H{"type": "error", "error": "Student is no longer assigned to this mentor"})
+				return
+			}
+			if at, err := markRead(c, pair); err == nil {
+				chatHub.Broadcast(room, gin.H{"type": "read", "by": pair.role, "at": at})
+			}
+		default:
+			client.Send(gin.H{"type": "error", "error": "unknown frame type"})
+		}
+	})
+
+	chatHub.Leave(room, client)
+	if !chatHub.Online(room, pair.role) {
+		chatHub.Broadcast(room, gin.H{"type": "presence", "role": pair.role, "online": false})
+	}
+}
+
+// chatHistory returns a page of messages, oldest first. Pass the smallest
+// id seen as ?before to fetch the page before it.
+func chatHistory(c *gin.Context, pair chatPair) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	query := dbFor(c).Where("student_id = ? AND mentor_id = ?", pair.student.ID, pair.mentor.ID)
+	if before, err := strconv.Atoi(c.Query("before")); err == nil {
+		query = query.Where("id < ?", before)
+	}
+
+	var messages []models.ChatMessage
+	if err := query.Order("id DESC").Limit(limit).Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	response := gin.H{"messages": messages, "peerOnline": chatHub.Online(pair.student.ID, pair.peer())}
+	if len(messages) == limit {
+		response["nextBefore"] = messages[0].ID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func chatRead(c *gin.Context, pair chatPair) {
+	at, err := markRead(c, pair)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	chatHub.Broadcast(pair.student.ID, gin.H{"type": "read", "by": pair.role, "at": at})
+	c.JSON(http.StatusOK, gin.H{"message": "Messages marked as read"})
+}
+
+func StudentChatWS(c *gin.Context) {
+	if pair, ok := studentChatPair(c); ok {
+		serveChat(c, pair)
+	}
+}
+
+func StudentChatHistory(c *gin.Context) {
+	if pair, ok := studentChatPair(c); ok {
+		chatHistory(c, pair)
+	}
+}
+
+func StudentChatRead(c *gin.Context) {
+	if pair, ok := studentChatPair(c); ok {
+		chatRead(c, pair)
+	}
+}
+
+func StudentChatUnread(c *gin.Context) {
+	pair, ok := studentChatPair(c)
+	if !ok {
+		return
+	}
+	count, err := unreadCount(c, pair)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread": count, "mentorOnline": chatHub.Online(pair.student.ID, "mentor")})
+}
+
+func MentorChatWS(c *gin.Context) {
+	if pair, ok := mentorChatPair(c); ok {
+		serveChat(c, pair)
+	}
+}
+
+func MentorChatHistory(c *gin.Context) {
+	if pair, ok := mentorChatPair(c); ok {
+		chatHistory(c, pair)
+	}
+}
+
+func MentorChatRead(c *gin.Context) {
+	if pair, ok := mentorChatPair(c); ok {
+		chatRead(c, pair)
+	}
+}
+
+// MentorChatUnread lists the mentor's current students with their unread
+// counts and whether they are online.
+func MentorChatUnread(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+	var students []UserSchema
+	if err := dbFor(c).Where("mentor = ? AND expired = ?", ment.Name, false).Order("name").Find(&students).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var counts []struct {
+		StudentID uint
+		Count     int64
+	}
+	if err := dbFor(c).Model(&models.ChatMessage{}).Select("student_id, COUNT(*) AS count").
+		Where("mentor_id = ? AND sender = ? AND read_at IS NULL", ment.ID, "student").
+		Group("student_id").Scan(&counts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	unread := make(map[uint]int64, len(counts))
+	for _, row := range counts {
+		unread[row.StudentID] = row.Count
+	}
+
+	conversations := make([]gin.H, 0, len(students))
+	for _, s := range students {
+		conversations = append(conversations, gin.H{
+			"studentId": s.ID,
+			"name":      s.Name,
+			"unread":    unread[s.ID],
+			"online":    chatHub.Online(s.ID, "student"),
+		})
+	}
+	c.JSON(http.StatusOK, conversations)
+}
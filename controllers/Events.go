@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"guidance/events"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// dashboardEvents keeps recent events for the owner dashboard feed
+var dashboardEvents = events.NewStream(500)
+
+func init() {
+	events.Subscribe(dashboardEvents.Publish)
+}
+
+// EventsStream is a server-sent events feed of enrollments, payments,
+// assignments and re-enrollments. Clients reconnecting with Last-Event-ID
+// get what they missed; if that is no longer available a "reset" event tells
+// them to reload /api/data and /api/mentorData instead.
+func EventsStream(c *gin.Context) {
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("lastEventId")
+	}
+	backlog, ch, complete, cancel := dashboardEvents.Subscribe(lastID)
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	io.WriteString(c.Writer, "retry: 5000\n\n")
+	if !complete {
+		c.Render(-1, sse.Event{Event: "reset", Data: gin.H{"reason": "missed events are no longer available"}})
+	}
+	for _, entry := range backlog {
+		c.Render(-1, sse.Event{Id: entry.ID, Event: entry.Event.Type, Data: entry.Event})
+	}
+	c.Writer.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-draining:
+			return false
+		case entry, ok := <-ch:
+			if !ok {
+				// dropped for falling behind, the client will resume from its last id
+				return false
+			}
+			c.Render(-1, sse.Event{Id: entry.ID, Event: entry.Event.Type, Data: entry.Event})
+			return true
+		case <-keepalive.C:
+			io.WriteString(w, ": keepalive\n\n")
+			return true
+		}
+	})
+}
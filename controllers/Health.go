@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"context"
+	"guidance/models"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// draining is closed once the server starts shutting down.
+var (
+	draining  = make(chan struct{})
+	drainOnce sync.Once
+)
+
+// Drain marks the server as shutting down: readiness starts failing so the
+// load balancer stops sending traffic, and the long-lived event streams and
+// chat sockets are closed so they do not hold up the shutdown.
+func Drain() {
+	drainOnce.Do(func() {
+		close(draining)
+		chatHub.Close()
+	})
+}
+
+// Healthz is the liveness probe. It only shows the process is serving.
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz is the readiness probe: the database answers, the tables have
+// been migrated and the server is not shutting down.
+func Readyz(c *gin.Context) {
+	select {
+	case <-draining:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	default:
+	}
+	if !models.Migrated() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "migrating"})
+		return
+	}
+
+	sqlDB, err := dbFor(c).DB()
+	if err == nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+		defer cancel()
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "database unreachable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
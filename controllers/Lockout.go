@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"guidance/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Failures older than this are forgotten.
+	failureWindow = 24 * time.Hour
+	maxDelay      = 30 * time.Second
+	maxLockout    = 24 * time.Hour
+)
+
+// credentialPolicy decides how long a key must wait after its latest
+// failure. From delayAfter failures on, each attempt has to wait twice as
+// long as the previous one; from lockAfter on the key is locked out, and
+// every further lockAfter failures double the lockout.
+type credentialPolicy struct {
+	delayAfter int
+	lockAfter  int
+	lockout    time.Duration
+}
+
+var (
+	accountPolicy = credentialPolicy{delayAfter: 3, lockAfter: 5, lockout: 15 * time.Minute}
+	// Shared addresses (schools, hostels, mobile NAT) fail more often, so
+	// the per-IP limits are looser.
+	addressPolicy = credentialPolicy{delayAfter: 10, lockAfter: 25, lockout: 15 * time.Minute}
+)
+
+func (p credentialPolicy) penalty(failures int) time.Duration {
+	switch {
+	case failures >= p.lockAfter:
+		d := p.lockout << uint((failures-p.lockAfter)/p.lockAfter)
+		if d <= 0 || d > maxLockout {
+			d = maxLockout
+		}
+		return d
+	case failures >= p.delayAfter:
+		d := time.Second << uint(failures-p.delayAfter+1)
+		if d > maxDelay {
+			d = maxDelay
+		}
+		return d
+	}
+	return 0
+}
+
+// until returns when a key with this failure record may try again, or the
+// zero time if it does not have to wait.
+func (p credentialPolicy) until(failure models.CredentialFailure, now time.Time) time.Time {
+	if now.Sub(failure.LastFailedAt) > failureWindow {
+		return time.Time{}
+	}
+	until := failure.LastFailedAt.Add(p.penalty(failure.Failures))
+	if until.After(now) {
+		return until
+	}
+	return time.Time{}
+}
+
+func accountKey(kind, identifier string) string {
+	return "account:" + kind + ":" + strings.ToLower(strings.TrimSpace(identifier))
+}
+
+func addressKey(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// blockedUntil returns when the key may try again, or the zero time.
+func blockedUntil(c *gin.Context, key string, policy credentialPolicy) time.Time {
+	var failure models.CredentialFailure
+	if err := dbFor(c).Where("key = ?", key).First(&failure).Error; err != nil {
+		return time.Time{}
+	}
+	return policy.until(failure, time.Now())
+}
+
+// credentialBlocked reports whether the account or the client address has
+// to wait before trying again, and if so responds with 429. An empty
+// identifier only checks the address.
+func credentialBlocked(c *gin.Context, kind, identifier string) bool {
+	until := blockedUntil(c, addressKey(c), addressPolicy)
+	if identifier != "" {
+		if t := blockedUntil(c, accountKey(kind, identifier), accountPolicy); t.After(until) {
+			until = t
+		}
+	}
+	if until.IsZero() {
+		return false
+	}
+	retry := int(time.Until(until).Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(retry))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+	return true
+}
+
+// credentialFailed records a failed check against the account and the
+// client address. Unknown accounts are counted too, so the lockout does not
+// reveal which accounts exist.
+func credentialFailed(c *gin.Context, kind, identifier string) {
+	keys := []string{addressKey(c)}
+	if identifier != "" {
+		keys = append(keys, accountKey(kind, identifier))
+	}
+	now := time.Now()
+	for _, key := range keys {
+		err := dbFor(c).Exec(`INSERT INTO credential_failures (key, failures, last_failed_at) VALUES (?, 1, ?)
+			ON CONFLICT (key) DO UPDATE SET
+				failures = CASE WHEN credential_failures.last_failed_at < ? THEN 1 ELSE credential_failures.failures + 1 END,
+				last_failed_at = EXCLUDED.last_failed_at`,
+			key, now, now.Add(-failureWindow)).Error
+		if err != nil {
+			logger(c).Error("lockout: failed to record failure", "scope", strings.SplitN(key, ":", 2)[0], "error", err)
+		}
+	}
+}
+
+// credentialSucceeded clears the account's failures. The address keeps its
+// count so one good login cannot hide a spray across many accounts.
+func credentialSucceeded(c *gin.Context, kind, identifier string) {
+	if err := dbFor(c).Where("key = ?", accountKey(kind, identifier)).Delete(&models.CredentialFailure{}).Error; err != nil {
+		logger(c).Error("lockout: failed to clear failures", "error", err)
+	}
+}
+
+// LockoutsGet lists accounts and addresses that are currently locked out.
+func LockoutsGet(c *gin.Context) {
+	var failures []models.CredentialFailure
+	if err := dbFor(c).Where("last_failed_at > ?", time.Now().Add(-failureWindow)).Order("last_failed_at DESC").Find(&failures).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	locked := []LockedAccount{}
+	for _, f := range failures {
+		policy := accountPolicy
+		if strings.HasPrefix(f.Key, "ip:") {
+			policy = addressPolicy
+		}
+		if f.Failures < policy.lockAfter {
+			continue
+		}
+		if until := policy.until(f, now); !until.IsZero() {
+			locked = append(locked, LockedAccount{Key: f.Key, Failures: f.Failures, LastFailedAt: f.LastFailedAt, LockedUntil: until})
+		}
+	}
+	c.JSON(http.StatusOK, locked)
+}
+
+// LockoutUnlock clears the failed attempts of an account, or of a client
+// address when account is "ip", so it can sign in again straight away.
+func LockoutUnlock(c *gin.Context) {
+	var input UnlockInput
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	key := accountKey(input.Account, input.Identifier)
+	if input.Account == "ip" {
+		key = "ip:" + strings.TrimSpace(input.Identifier)
+	}
+	result := dbFor(c).Where("key = ?", key).Delete(&models.CredentialFailure{})
+	if result.Error != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Account is not locked"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked successfully"})
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"guidance/models"
+	"testing"
+	"time"
+)
+
+func TestPenaltyEscalation(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   credentialPolicy
+		failures int
+		want     time.Duration
+	}{
+		{"account, no failures", accountPolicy, 0, 0},
+		{"account, below delay", accountPolicy, 2, 0},
+		{"account, first delay", accountPolicy, 3, 2 * time.Second},
+		{"account, delay doubles", accountPolicy, 4, 4 * time.Second},
+		{"account, locked", accountPolicy, 5, 15 * time.Minute},
+		{"account, same lockout until next block", accountPolicy, 9, 15 * time.Minute},
+		{"account, second block doubles", accountPolicy, 10, 30 * time.Minute},
+		{"account, third block", accountPolicy, 15, time.Hour},
+		{"account, sixth block", accountPolicy, 35, 16 * time.Hour},
+		{"account, capped", accountPolicy, 40, maxLockout},
+		{"account, shift overflow capped", accountPolicy, 1000, maxLockout},
+		{"address, below delay", addressPolicy, 9, 0},
+		{"address, first delay", addressPolicy, 10, 2 * time.Second},
+		{"address, delay", addressPolicy, 13, 16 * time.Second},
+		{"address, delay capped", addressPolicy, 14, maxDelay},
+		{"address, delay capped before lock", addressPolicy, 24, maxDelay},
+		{"address, locked", addressPolicy, 25, 15 * time.Minute},
+		{"address, second block doubles", addressPolicy, 50, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.penalty(tt.failures); got != tt.want {
+				t.Errorf("penalty(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPenaltyNeverDecreases(t *testing.T) {
+	for _, policy := range []credentialPolicy{accountPolicy, addressPolicy} {
+		prev := time.Duration(0)
+		for failures := 0; failures <= 200; failures++ {
+			d := policy.penalty(failures)
+			if d < prev {
+				t.Fatalf("penalty(%d) = %v is less than penalty(%d) = %v", failures, d, failures-1, prev)
+			}
+			prev = d
+		}
+	}
+}
+
+func TestPolicyUntil(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		failure models.CredentialFailure
+		want    time.Time
+	}{
+		{"no delay yet", models.CredentialFailure{Failures: 2, LastFailedAt: now}, time.Time{}},
+		{"delayed", models.CredentialFailure{Failures: 3, LastFailedAt: now.Add(-time.Second)}, now.Add(time.Second)},
+		{"delay over", models.CredentialFailure{Failures: 3, LastFailedAt: now.Add(-2 * time.Second)}, time.Time{}},
+		{"locked", models.CredentialFailure{Failures: 5, LastFailedAt: now.Add(-5 * time.Minute)}, now.Add(10 * time.Minute)},
+		{"lockout over", models.CredentialFailure{Failures: 5, LastFailedAt: now.Add(-15 * time.Minute)}, time.Time{}},
+		{"outside the window", models.CredentialFailure{Failures: 40, LastFailedAt: now.Add(-failureWindow - time.Second)}, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := accountPolicy.until(tt.failure, now); !got.Equal(tt.want) {
+				t.Errorf("until = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccountKey(t *testing.T) {
+	if got, want := accountKey("mentor", "  Alice@Example.com "), "account:mentor:alice@example.com"; got != want {
+		t.Errorf("accountKey = %q, want %q", got, want)
+	}
+	if accountKey("mentor", "a") == accountKey("owner", "a") {
+		t.Error("accountKey must keep account kinds apart")
+	}
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const mentorSessionTTL = 12 * time.Hour
+
+// RequireMentor guards the mentor routes. The session belongs to the
+// mentor's login, see currentMentor for the profile.
+func RequireMentor() gin.HandlerFunc {
+	return requireSession("mentor")
+}
+
+// currentMentor loads the profile of the signed in mentor. Logins and
+// profiles are linked by the mentor's name.
+func currentMentor(c *gin.Context) (MentorSchema, bool) {
+	var ment MentorSchema
+	var cred MentorLogin
+	if err := dbFor(c).First(&cred, c.GetUint("principalID")).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return ment, false
+	}
+	if err := dbFor(c).Where("name = ?", cred.MentorName).First(&ment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Mentor profile not found"})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return ment, false
+	}
+	return ment, true
+}
+
+// MentorLoginPost checks a mentor's password and starts a session.
+func MentorLoginPost(c *gin.Context) {
+	var input MentorLoginInput
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if credentialBlocked(c, "mentor", input.Email) {
+		return
+	}
+
+	var cred MentorLogin
+	if err := dbFor(c).Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(input.Email))).First(&cred).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			credentialFailed(c, "mentor", input.Email)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to find existing user with this email"})
+		}
+		return
+	}
+	if err := comparePassword(cred.Password, input.Password); err != nil {
+		credentialFailed(c, "mentor", input.Email)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+	credentialSucceeded(c, "mentor", input.Email)
+
+	var ment MentorSchema
+	if err := dbFor(c).Where("name = ?", cred.MentorName).First(&ment).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to find mentor profile"})
+		return
+	}
+	token, expiresAt, err := issueSession(c, "mentor", cred.ID, mentorSessionTTL)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": token, "expiresAt": expiresAt, "mentor": ment})
+}
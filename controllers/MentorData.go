@@ -2,65 +2,18 @@ package controllers
 
 import (
 	"errors"
-	"fmt"
+	"guidance/events"
 	"guidance/models"
-	"log"
+	"guidance/notify"
 	"net/http"
-	"os"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Error loading .env file")
-	}
-
-	host := os.Getenv("DB_HOST")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbname := os.Getenv("DB_NAME")
-	port := os.Getenv("DB_PORT")
-
-	dsn := "host=" + host + " user=" + user + " password=" + password + " dbname=" + dbname + " port=" + port
-
-	// Implement retry logic
-	var database *gorm.DB
-	var err error
-	maxRetries := 5
-	for i := 0; i < maxRetries; i++ {
-		database, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-		if err == nil {
-			break
-		}
-		log.Printf("Failed to connect to database (attempt %d/%d): %v", i+1, maxRetries, err)
-		time.Sleep(2 * time.Second) // Wait before retrying
-	}
-	if err != nil {
-		log.Fatalf("Failed to connect to database after %d attempts: %v", maxRetries, err)
-	}
-
-	db2 = database
-
-	// Set the maximum number of open connections in the connection pool
-	sqlDB, err := db2.DB()
-	if err != nil {
-		log.Fatalf("Failed to get database connection: %v", err)
-	}
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetConnMaxLifetime(time.Hour)
-
-	log.Println("Successfully connected to the database")
-}
-
 func hashPassword(password string) (string, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -80,7 +33,7 @@ func comparePassword(hashedPassword, password string) error {
 func MentorGet(c *gin.Context) {
 	var wg1 sync.WaitGroup
 
-	rows, err := db2.Model(&MentorSchema{}).Rows()
+	rows, err := dbFor(c).Model(&MentorSchema{}).Rows()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -92,7 +45,7 @@ func MentorGet(c *gin.Context) {
 	for rows.Next() {
 		var mentor MentorSchema
 		// here go routines can't be used as then db would be called by all at the same time
-		if err := db2.ScanRows(rows, &mentor); err != nil {
+		if err := dbFor(c).ScanRows(rows, &mentor); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -118,6 +71,11 @@ func MentorGet(c *gin.Context) {
 		mentors = append(mentors, mentor)
 	}
 
+	if err := attachRatings(c, mentors); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, mentors)
 }
 
@@ -138,7 +96,7 @@ func MentorPost(c *gin.Context) {
 	go func(input Mentor) {
 		defer wg1.Done()
 		mentor := MentorSchema{}
-		if err := db2.Where("phone=?", input.Phone).First(&mentor).Error; err != nil {
+		if err := dbFor(c).Where("phone=?", input.Phone).First(&mentor).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				// No user found, it's safe to proceed with creating a new user
 				resultChan <- 1
@@ -165,7 +123,7 @@ func MentorPost(c *gin.Context) {
 	}
 
 	data := models.MentorSchema{Name: input.Name, College: input.College, Date: input.Date, Phone: input.Phone}
-	if err := db2.Create(&data).Error; err != nil {
+	if err := dbFor(c).Create(&data).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
 		return
 	}
@@ -177,7 +135,7 @@ func MentorPost(c *gin.Context) {
 	go func(input Mentor) {
 		defer wg1.Done()
 		cred := MentorLogin{}
-		if err := db2.Where("email=?", input.Email).First(&cred).Error; err != nil {
+		if err := dbFor(c).Where("email=?", input.Email).First(&cred).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				// No user found, it's safe to proceed with creating a new user
 				newChan <- 1
@@ -186,7 +144,6 @@ func MentorPost(c *gin.Context) {
 				newChan <- 3
 			}
 		} else {
-			fmt.Println(cred)
 			newChan <- 2
 		}
 	}(input)
@@ -212,28 +169,26 @@ func MentorPost(c *gin.Context) {
 	}
 
 	otherdata := models.MentorLogin{Email: input.Email, Password: hashed, MentorName: input.Name}
-	if err := db2.Create(&otherdata).Error; err != nil {
+	if err := dbFor(c).Create(&otherdata).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
 		return
 	}
 
+	events.Publish(events.MentorCreated, data)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Mentor data saved successfully"})
 }
 
 // updating mentors capacity
 func MentorStudentUpdate(c *gin.Context) {
 	var input UpdateCount
-	fmt.Println(c)
 	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		fmt.Println(input)
 		return
 	}
 
-	fmt.Println(input)
-
 	cred := MentorSchema{}
-	if err := db2.Where("name=?", input.MentorName).First(&cred).Error; err != nil {
+	if err := dbFor(c).Where("name=?", input.MentorName).First(&cred).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to Find existing user with this Name"})
 		return
 	}
@@ -253,7 +208,7 @@ func MentorStudentUpdate(c *gin.Context) {
 	}
 	cred.Handle = number //increasing it by the value of students came in request
 
-	if err := db2.Save(&cred).Error; err != nil {
+	if err := dbFor(c).Save(&cred).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
 		return
 	}
@@ -272,14 +227,14 @@ func MentorInfoUpdate(c *gin.Context) {
 
 	var user MentorSchema
 	var cred MentorLogin
-	if err := db2.Where("phone=?", phone).First(&user).Error; err != nil {
+	if err := dbFor(c).Where("phone=?", phone).First(&user).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to Find existing user with this PhoneNo"})
 		return
 	}
 
 	naam := user.Name
 
-	if err := db2.Where("mentor_name=?", naam).First(&cred).Error; err != nil {
+	if err := dbFor(c).Where("mentor_name=?", naam).First(&cred).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to Find existing user with this Name"})
 		return
 	}
@@ -292,11 +247,11 @@ func MentorInfoUpdate(c *gin.Context) {
 
 	// log.Fatalln("executed")
 
-	if err := db2.Save(&user).Error; err != nil {
+	if err := dbFor(c).Save(&user).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
 		return
 	}
-	if err := db2.Save(&cred).Error; err != nil {
+	if err := dbFor(c).Save(&cred).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
 		return
 	}
@@ -313,10 +268,15 @@ func ChangePassword(c *gin.Context) {
 
 	// fmt.Println(input.Email)
 
+	if credentialBlocked(c, "mentor", input.Email) {
+		return
+	}
+
 	var user MentorLogin
-	if err := db2.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(input.Email))).First(&user).Error; err != nil {
+	if err := dbFor(c).Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(input.Email))).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "User with this email not found"})
+			credentialFailed(c, "mentor", input.Email)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		} else {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to find existing user with this email"})
 		}
@@ -325,144 +285,122 @@ func ChangePassword(c *gin.Context) {
 
 	err := comparePassword(user.Password, input.OldPassword)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		credentialFailed(c, "mentor", input.Email)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	} else {
+		credentialSucceeded(c, "mentor", input.Email)
 		hashedNew, err := hashPassword(input.NewPassword)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
 			return
 		}
 		user.Password = hashedNew
-		if err := db2.Save(&user).Error; err != nil {
+		if err := dbFor(c).Save(&user).Error; err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
 			return
 		}
+		// Sign out other devices that may have the old password
+		if err := revokeSessions(c, "mentor", user.ID); err != nil {
+			logger(c).Error("failed to revoke mentor sessions", "error", err)
+		}
 	}
+	sendEmail(user.Email, notify.PasswordChanged, gin.H{"Name": user.MentorName})
 	c.JSON(http.StatusOK, gin.H{"message": "Mentor Password updated successfully"})
 
 }
 
+// FinalMentor assigns the selected students to a mentor. Only students who
+// are not expired and not already with this mentor take a slot, and each
+// one's previous mentor gets theirs back, the same as MentorUpdate.
 func FinalMentor(c *gin.Context) {
 	var input FinalMentorSchema
-	fmt.Println(1)
 	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
-		fmt.Println(input)
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	fmt.Println(2)
-	selectedStudentCount := len(input.IDs)
 	var ment MentorSchema
-	if err := db2.Where("name = ?", input.MentorName).First(&ment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	fmt.Println(3)
-
-	if ment.Onn+selectedStudentCount > ment.Handle {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "mentor can't handle this much"})
-		return
-	}
-	fmt.Println(4)
-	ment.Onn = ment.Onn + selectedStudentCount
-	ment.Total = ment.Total + selectedStudentCount
-
-	if err := db2.Save(&ment).Error; err != nil {
+	if err := dbFor(c).Where("name = ?", input.MentorName).First(&ment).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	fmt.Println(5)
-	// Collect all rows in a slice
-	var mu sync.Mutex
 
-	fmt.Println(input)
-
-	// Initialize students slice
 	var students []UserSchema
-	var phoneNumbers []string
-	var wg sync.WaitGroup
-	// Iterate over the IDs and fetch records concurrently
-	fmt.Println(6)
-	for _, id := range input.IDs {
-		// Increment the wait group counter
-		wg.Add(1)
-
-		// Launch a Goroutine to fetch the record
-		go func(id int) {
-			defer wg.Done()
-
-			// Fetch the record with the given ID
-			var user UserSchema
-			result := db2.First(&user, id)
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		var selected []UserSchema
+		if err := tx.Where("id IN ?", input.IDs).Find(&selected).Error; err != nil {
+			return err
+		}
+		unique := map[int]bool{}
+		for _, id := range input.IDs {
+			unique[id] = true
+		}
+		if len(selected) != len(unique) {
+			return gorm.ErrRecordNotFound
+		}
 
-			// Check for errors
-			if err := result.Error; err != nil {
-				// Handle error (e.g., log it)
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
+		active := 0
+		for _, user := range selected {
+			if user.Mentor == ment.Name {
+				continue
 			}
-
-			// Lock the mutex before appending to the students slice
-			mu.Lock()
-			defer mu.Unlock()
-
-			// Append the fetched record to the students slice
-			students = append(students, user)
-			fmt.Println(user.Phone)
-			phoneNumbers = append(phoneNumbers, user.Phone)
-		}(id)
-	}
-
-	wg.Wait()
-	fmt.Println(7, phoneNumbers)
-
-	for _, id := range input.IDs {
-		wg.Add(1)
-
-		go func(id int) {
-			defer wg.Done()
-			var user UserSchema
-			if err := db3.Where("id = ?", id).First(&user).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
+			if !user.Expired {
+				active++
+				if user.Mentor != "" {
+					if err := tx.Model(&MentorSchema{}).Where("name = ? AND onn > 0", user.Mentor).Update("onn", gorm.Expr("onn - 1")).Error; err != nil {
+						return err
+					}
+				}
 			}
-
-			mu.Lock()
-			defer mu.Unlock()
-
-			user.Mentor = input.MentorName
-			if err := db2.Save(&user).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
+			if err := tx.Model(&user).Update("mentor", ment.Name).Error; err != nil {
+				return err
 			}
-		}(id)
-	}
-	wg.Wait()
-
-	for _, phone := range phoneNumbers {
-		wg.Add(1)
-
-		go func(phone string) {
-			defer wg.Done()
-			var reuser RenrollSchema
-			if err := db2.Where("phone = ?", phone).First(&reuser).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
+			if err := tx.Model(&RenrollSchema{}).Where("phone = ?", user.Phone).Update("mentor", ment.Name).Error; err != nil {
+				return err
+			}
+			if err := moveOpenTickets(tx, user.ID, ment.ID); err != nil {
+				return err
 			}
+			students = append(students, user)
+		}
+		if len(students) == 0 {
+			return nil
+		}
 
-			mu.Lock()
-			defer mu.Unlock()
+		result := tx.Model(&ment).Where("onn + ? <= handle", active).Updates(map[string]interface{}{
+			"onn":   gorm.Expr("onn + ?", active),
+			"total": gorm.Expr("total + ?", len(students)),
+		})
+		if result.Error == nil && result.RowsAffected == 0 {
+			return errMentorFull
+		}
+		return result.Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Student not found"})
+		return
+	} else if errors.Is(err, errMentorFull) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "mentor can't handle this much"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-			reuser.Mentor = input.MentorName
-			if err := db2.Save(&reuser).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-		}(phone)
+	if len(students) > 0 {
+		var cred MentorLogin
+		if err := dbFor(c).Where("mentor_name = ?", ment.Name).First(&cred).Error; err == nil {
+			sendEmail(cred.Email, notify.MentorAssigned, gin.H{"Mentor": ment.Name, "Students": students})
+		}
+	}
+	for _, student := range students {
+		student.Mentor = ment.Name
+		events.Publish(events.StudentAssigned, events.Student{
+			ID: student.ID, Name: student.Name, Phone: student.Phone, Email: student.Email, Date: student.Date,
+			Class: student.Class, Sub: student.Sub, Mentor: student.Mentor, Expired: student.Expired,
+		})
+		sendText(student.Phone, notify.StudentMentorAssigned, gin.H{"Name": student.Name, "Mentor": ment.Name, "MentorPhone": ment.Phone})
 	}
-	wg.Wait()
 
 	c.JSON(http.StatusOK, gin.H{"message": "Mentor and students updated successfully"})
 }
@@ -470,7 +408,7 @@ func FinalMentor(c *gin.Context) {
 func DelMentorGet(c *gin.Context) {
 	var wg1 sync.WaitGroup
 
-	rows, err := db2.Model(&MentorSchema{}).Rows()
+	rows, err := dbFor(c).Model(&MentorSchema{}).Rows()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -482,7 +420,7 @@ func DelMentorGet(c *gin.Context) {
 	for rows.Next() {
 		var mentor MentorSchema
 		// here go routines can't be used as then db would be called by all at the same time
-		if err := db2.ScanRows(rows, &mentor); err != nil {
+		if err := dbFor(c).ScanRows(rows, &mentor); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -517,13 +455,9 @@ func DelMentorGet(c *gin.Context) {
 func DelMentor(c *gin.Context) {
 	var input deleteMentSchema
 	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
-		fmt.Println("2")
-		fmt.Println(input)
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	fmt.Println("1")
-	fmt.Println(input)
 
 	// Create a wait group to wait for all Goroutines to finish
 	var wg sync.WaitGroup
@@ -538,7 +472,7 @@ func DelMentor(c *gin.Context) {
 			defer wg.Done()
 
 			// Construct the delete query
-			result := db2.Where("id=?", id).Delete(&MentorSchema{})
+			result := dbFor(c).Where("id=?", id).Delete(&MentorSchema{})
 
 			// Check for errors
 			if err := result.Error; err != nil {
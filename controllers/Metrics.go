@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Set from the config by Setup.
+var metricsToken string
+
+var metricsHandler = promhttp.Handler()
+
+// Metrics serves the Prometheus metrics to a scraper sending the configured
+// token as a bearer token, since the mentor gauges carry names. Without a
+// token the endpoint is disabled.
+func Metrics(c *gin.Context) {
+	if metricsToken == "" {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Metrics are disabled"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(bearerToken(c)), []byte(metricsToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid metrics token"})
+		return
+	}
+	metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
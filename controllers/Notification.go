@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"guidance/notify"
+	"log/slog"
+)
+
+var notifier *notify.Service
+
+// SetNotifier wires the notification service used by the handlers. Until it
+// is called, notifications are silently skipped.
+func SetNotifier(s *notify.Service) {
+	notifier = s
+}
+
+// sendEmail queues a templated email. Failures are logged rather than
+// returned so a notification problem never fails the request that caused it.
+func sendEmail(to, tmpl string, data interface{}) {
+	if notifier == nil || to == "" {
+		return
+	}
+	if err := notifier.Email(to, tmpl, data); err != nil {
+		slog.Error("Failed to queue email", "template", tmpl, "to", to, "error", err)
+	}
+}
+
+// sendText queues a templated WhatsApp/SMS message, logging any failure.
+func sendText(phone, tmpl string, data interface{}) {
+	if notifier == nil || phone == "" {
+		return
+	}
+	if err := notifier.Text(phone, tmpl, data); err != nil {
+		slog.Error("Failed to queue message", "template", tmpl, "phone", phone, "error", err)
+	}
+}
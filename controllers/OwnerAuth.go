@@ -0,0 +1,372 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"guidance/models"
+	"guidance/totp"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	ownerSessionTTL = 12 * time.Hour
+	// Time allowed between the password step and the second factor, and to
+	// finish a forced 2FA enrollment.
+	ownerMFATTL       = 5 * time.Minute
+	ownerEnrollTTL    = 15 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// Set from the config by Setup.
+var (
+	totpIssuer = "JEE Simplified"
+	// requireOwner2FA makes every owner enable 2FA before they can sign in.
+	requireOwner2FA = false
+)
+
+// RequireOwner guards routes that need a fully signed in owner.
+func RequireOwner() gin.HandlerFunc {
+	return requireSession("owner")
+}
+
+// RequireOwnerEnrollment also lets through owners who still have to set up
+// 2FA before they get a full session.
+func RequireOwnerEnrollment() gin.HandlerFunc {
+	return requireSession("owner", "owner-enroll")
+}
+
+// RequireOwnerOrBootstrap lets the very first owner account be created
+// without signing in. Once an owner exists it behaves like RequireOwner.
+func RequireOwnerOrBootstrap() gin.HandlerFunc {
+	requireOwner := RequireOwner()
+	return func(c *gin.Context) {
+		var owners int64
+		if err := dbFor(c).Model(&OwnerSchema{}).Count(&owners).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing owners"})
+			return
+		}
+		if owners == 0 {
+			c.Next()
+			return
+		}
+		requireOwner(c)
+	}
+}
+
+func currentOwner(c *gin.Context) (OwnerSchema, bool) {
+	var owner OwnerSchema
+	if err := dbFor(c).First(&owner, c.GetUint("principalID")).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return owner, false
+	}
+	return owner, true
+}
+
+// checkTOTP validates a code against the owner's secret and records its step
+// so the same code cannot be used twice.
+func checkTOTP(c *gin.Context, owner *OwnerSchema, code string) bool {
+	step, ok := totp.ValidateAfter(owner.TotpSecret, code, time.Now(), owner.TotpLastStep)
+	if !ok {
+		return false
+	}
+	result := dbFor(c).Model(&OwnerSchema{}).Where("id = ? AND totp_last_step < ?", owner.ID, step).Update("totp_last_step", step)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	owner.TotpLastStep = step
+	return true
+}
+
+// recoveryCodeHash hashes a recovery code the way it is stored. The dash and
+// case are ignored so codes can be typed as shown or not.
+func recoveryCodeHash(code string) string {
+	return hashToken(strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", "")))
+}
+
+// useRecoveryCode spends one of the owner's recovery codes.
+func useRecoveryCode(c *gin.Context, ownerID uint, code string) bool {
+	result := dbFor(c).Model(&models.RecoveryCode{}).
+		Where("owner_id = ? AND code_hash = ? AND used_at IS NULL", ownerID, recoveryCodeHash(code)).
+		Update("used_at", time.Now())
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// newRecoveryCodes replaces the owner's recovery codes and returns the new
+// ones in XXXXX-XXXXX form. They are shown once and only hashes are kept.
+func newRecoveryCodes(c *gin.Context, ownerID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := base32.StdEncoding.EncodeToString(b)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		rows[i] = models.RecoveryCode{OwnerID: ownerID, CodeHash: recoveryCodeHash(codes[i])}
+	}
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("owner_id = ?", ownerID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&rows).Error
+	})
+	return codes, err
+}
+
+// OwnerLogin checks an owner's password. Owners with 2FA get a short lived
+// mfaToken to exchange at /auth/owner/verify; when 2FA is required and not
+// yet set up, the token only allows enrolling.
+func OwnerLogin(c *gin.Context) {
+	var input OwnerLoginInput
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if credentialBlocked(c, "owner", input.Email) {
+		return
+	}
+
+	var owner OwnerSchema
+	if err := dbFor(c).Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(input.Email))).First(&owner).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			credentialFailed(c, "owner", input.Email)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to find existing user with this email"})
+		}
+		return
+	}
+	if err := comparePassword(owner.Password, input.Password); err != nil {
+		credentialFailed(c, "owner", input.Email)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+
+	switch {
+	case owner.TotpEnabled:
+		token, expiresAt, err := issueSession(c, "owner-mfa", owner.ID, ownerMFATTL)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"mfaRequired": true, "mfaToken": token, "expiresAt": expiresAt})
+	case requireOwner2FA:
+		credentialSucceeded(c, "owner", input.Email)
+		token, expiresAt, err := issueSession(c, "owner-enroll", owner.ID, ownerEnrollTTL)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"mfaSetupRequired": true, "token": token, "expiresAt": expiresAt})
+	default:
+		credentialSucceeded(c, "owner", input.Email)
+		token, expiresAt, err := issueSession(c, "owner", owner.ID, ownerSessionTTL)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"token": token, "expiresAt": expiresAt, "owner": owner})
+	}
+}
+
+// OwnerLoginVerify exchanges an mfaToken and a TOTP or recovery code for an
+// owner session.
+func OwnerLoginVerify(c *gin.Context) {
+	var input OwnerMFAInput
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	invalid := gin.H{"error": "Invalid or expired code"}
+
+	var pending models.LoginSession
+	if err := dbFor(c).Where("token_hash = ? AND kind = ? AND expires_at > ?", hashToken(input.MFAToken), "owner-mfa", time.Now()).First(&pending).Error; err != nil {
+		if credentialBlocked(c, "owner", "") {
+			return
+		}
+		credentialFailed(c, "owner", "")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, invalid)
+		return
+	}
+	var owner OwnerSchema
+	if err := dbFor(c).First(&owner, pending.PrincipalID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, invalid)
+		return
+	}
+	if credentialBlocked(c, "owner", owner.Email) {
+		return
+	}
+	if !checkTOTP(c, &owner, input.Code) && !useRecoveryCode(c, owner.ID, input.Code) {
+		credentialFailed(c, "owner", owner.Email)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, invalid)
+		return
+	}
+
+	credentialSucceeded(c, "owner", owner.Email)
+	dbFor(c).Delete(&pending)
+	token, expiresAt, err := issueSession(c, "owner", owner.ID, ownerSessionTTL)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": token, "expiresAt": expiresAt, "owner": owner})
+}
+
+// TOTPSetup starts 2FA enrollment by generating a new secret. 2FA is not on
+// until the first code is confirmed with TOTPEnable.
+func TOTPSetup(c *gin.Context) {
+	owner, ok := currentOwner(c)
+	if !ok {
+		return
+	}
+	if owner.TotpEnabled {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	if err := dbFor(c).Model(&owner).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "uri": totp.URI(totpIssuer, owner.Email, secret)})
+}
+
+// TOTPEnable confirms enrollment with a code from the authenticator app and
+// returns the recovery codes. An owner finishing forced enrollment also gets
+// their full session here.
+func TOTPEnable(c *gin.Context) {
+	var input TOTPCodeInput
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	owner, ok := currentOwner(c)
+	if !ok {
+		return
+	}
+	if owner.TotpEnabled {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if owner.TotpSecret == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Start setup first"})
+		return
+	}
+	if credentialBlocked(c, "owner", owner.Email) {
+		return
+	}
+	if !checkTOTP(c, &owner, input.Code) {
+		credentialFailed(c, "owner", owner.Email)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+	credentialSucceeded(c, "owner", owner.Email)
+
+	if err := dbFor(c).Model(&owner).Update("totp_enabled", true).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	codes, err := newRecoveryCodes(c, owner.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	response := gin.H{"message": "Two-factor authentication enabled successfully", "recoveryCodes": codes}
+
+	if c.GetString("sessionKind") == "owner-enroll" {
+		dbFor(c).Delete(&models.LoginSession{}, c.GetUint("sessionID"))
+		token, expiresAt, err := issueSession(c, "owner", owner.ID, ownerSessionTTL)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+			return
+		}
+		response["token"] = token
+		response["expiresAt"] = expiresAt
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// TOTPDisable turns 2FA off. It needs the password and a current code, and
+// is refused while 2FA is required for all owners.
+func TOTPDisable(c *gin.Context) {
+	var input TOTPDisableInput
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if requireOwner2FA {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for owners"})
+		return
+	}
+	owner, ok := currentOwner(c)
+	if !ok {
+		return
+	}
+	if !owner.TotpEnabled {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if credentialBlocked(c, "owner", owner.Email) {
+		return
+	}
+	if comparePassword(owner.Password, input.Password) != nil || (!checkTOTP(c, &owner, input.Code) && !useRecoveryCode(c, owner.ID, input.Code)) {
+		credentialFailed(c, "owner", owner.Email)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid password or code"})
+		return
+	}
+	credentialSucceeded(c, "owner", owner.Email)
+
+	err := dbFor(c).Model(&owner).Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error
+	if err == nil {
+		err = dbFor(c).Where("owner_id = ?", owner.ID).Delete(&models.RecoveryCode{}).Error
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled successfully"})
+}
+
+// RecoveryCodesPost replaces the owner's recovery codes after checking a
+// current TOTP code.
+func RecoveryCodesPost(c *gin.Context) {
+	var input TOTPCodeInput
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	owner, ok := currentOwner(c)
+	if !ok {
+		return
+	}
+	if !owner.TotpEnabled {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if credentialBlocked(c, "owner", owner.Email) {
+		return
+	}
+	if !checkTOTP(c, &owner, input.Code) {
+		credentialFailed(c, "owner", owner.Email)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+	credentialSucceeded(c, "owner", owner.Email)
+	codes, err := newRecoveryCodes(c, owner.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
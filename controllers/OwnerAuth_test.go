@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecoveryCodeHash(t *testing.T) {
+	stored := recoveryCodeHash("ABCDE-FGHIJ")
+
+	tests := []struct {
+		name  string
+		code  string
+		match bool
+	}{
+		{"as shown", "ABCDE-FGHIJ", true},
+		{"without dash", "ABCDEFGHIJ", true},
+		{"lower case", "abcde-fghij", true},
+		{"surrounding spaces", "  ABCDE-FGHIJ\n", true},
+		{"one character off", "ABCDE-FGHIK", false},
+		{"truncated", "ABCDE-FGHI", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recoveryCodeHash(tt.code) == stored; got != tt.match {
+				t.Errorf("recoveryCodeHash(%q) matches = %v, want %v", tt.code, got, tt.match)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodeHashHidesCode(t *testing.T) {
+	hash := recoveryCodeHash("ABCDE-FGHIJ")
+	if strings.Contains(strings.ToUpper(hash), "ABCDE") || len(hash) != 64 {
+		t.Errorf("recoveryCodeHash = %q, want a 64 character digest", hash)
+	}
+}
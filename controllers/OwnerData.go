@@ -3,66 +3,18 @@ package controllers
 import (
 	"errors"
 	"guidance/models"
-	"log"
 	"net/http"
-	"os"
 	"sync"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Error loading .env file")
-	}
-
-	host := os.Getenv("DB_HOST")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbname := os.Getenv("DB_NAME")
-	port := os.Getenv("DB_PORT")
-
-	dsn := "host=" + host + " user=" + user + " password=" + password + " dbname=" + dbname + " port=" + port
-
-	// Implement retry logic
-	var database *gorm.DB
-	var err error
-	maxRetries := 5
-	for i := 0; i < maxRetries; i++ {
-		database, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-		if err == nil {
-			break
-		}
-		log.Printf("Failed to connect to database (attempt %d/%d): %v", i+1, maxRetries, err)
-		time.Sleep(2 * time.Second) // Wait before retrying
-	}
-	if err != nil {
-		log.Fatalf("Failed to connect to database after %d attempts: %v", maxRetries, err)
-	}
-
-	db5 = database
-
-	// Set the maximum number of open connections in the connection pool
-	sqlDB, err := db5.DB()
-	if err != nil {
-		log.Fatalf("Failed to get database connection: %v", err)
-	}
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetConnMaxLifetime(time.Hour)
-
-	log.Println("Successfully connected to the database")
-}
-
 func OwnerGet(c *gin.Context) {
 	var wg sync.WaitGroup
 
 	// Query the database to get all owners
-	rows, err := db5.Model(&OwnerSchema{}).Rows()
+	rows, err := dbFor(c).Model(&OwnerSchema{}).Rows()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -73,7 +25,7 @@ func OwnerGet(c *gin.Context) {
 	var ownerSchemas []OwnerSchema
 	for rows.Next() {
 		var owner OwnerSchema
-		if err := db5.ScanRows(rows, &owner); err != nil {
+		if err := dbFor(c).ScanRows(rows, &owner); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -124,7 +76,7 @@ func OwnerPost(c *gin.Context) {
 	go func(input Owner) {
 		defer wg.Done()
 		naam := OwnerSchema{}
-		if err := db5.Where("email = ?", input.Email).First(&naam).Error; err != nil {
+		if err := dbFor(c).Where("email = ?", input.Email).First(&naam).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				// No owner found, it's safe to proceed with creating a new owner
 				resultChan <- 1
@@ -159,7 +111,7 @@ func OwnerPost(c *gin.Context) {
 	}
 	// If owner doesn't exist, proceed with saving the owner
 	data := models.OwnerSchema{Email: input.Email, Password: hashed, OwnerName: input.OwnerName}
-	if err := db5.Create(&data).Error; err != nil {
+	if err := dbFor(c).Create(&data).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
 		return
 	}
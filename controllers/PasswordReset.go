@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"errors"
+	"guidance/models"
+	"guidance/notify"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const passwordResetTTL = time.Hour
+
+// passwordResetURL is the frontend page that accepts the token, e.g.
+// https://example.com/reset-password. The token is appended as ?token=.
+// Set from the config by Setup.
+var passwordResetURL = "http://localhost:3000/reset-password"
+
+// resetAccount is the part of a mentor or owner account the reset flow needs.
+type resetAccount struct {
+	ID    uint
+	Email string
+	Name  string
+}
+
+func findResetAccount(c *gin.Context, kind, email string) (resetAccount, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if kind == "owner" {
+		var owner OwnerSchema
+		err := dbFor(c).Where("LOWER(email) = ?", email).First(&owner).Error
+		return resetAccount{ID: owner.ID, Email: owner.Email, Name: owner.OwnerName}, err
+	}
+	var mentor MentorLogin
+	err := dbFor(c).Where("LOWER(email) = ?", email).First(&mentor).Error
+	return resetAccount{ID: mentor.ID, Email: mentor.Email, Name: mentor.MentorName}, err
+}
+
+// resetUsable reports whether a reset token may still be redeemed: it has
+// not expired and has not been used, so each emailed link works once.
+func resetUsable(reset models.PasswordReset, now time.Time) bool {
+	return reset.UsedAt == nil && now.Before(reset.ExpiresAt)
+}
+
+func resetLink(token string) string {
+	sep := "?"
+	if strings.Contains(passwordResetURL, "?") {
+		sep = "&"
+	}
+	return passwordResetURL + sep + "token=" + url.QueryEscape(token)
+}
+
+// PasswordResetRequestPost mails a reset link to a mentor or owner. The
+// response is the same whether or not the account exists.
+func PasswordResetRequestPost(c *gin.Context) {
+	var input PasswordResetRequest
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	response := gin.H{"message": "If an account exists, a reset link has been sent"}
+
+	account, err := findResetAccount(c, input.Account, input.Email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusOK, response)
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing user"})
+		}
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	// Only the newest link works
+	now := time.Now()
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PasswordReset{}).Where("kind = ? AND principal_id = ? AND used_at IS NULL", input.Account, account.ID).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordReset{
+			Kind:        input.Account,
+			PrincipalID: account.ID,
+			TokenHash:   hashToken(token),
+			ExpiresAt:   now.Add(passwordResetTTL),
+		}).Error
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+
+	sendEmail(account.Email, notify.PasswordReset, gin.H{
+		"Name":    account.Name,
+		"Link":    resetLink(token),
+		"Minutes": int(passwordResetTTL.Minutes()),
+	})
+	c.JSON(http.StatusOK, response)
+}
+
+// PasswordResetConfirmPost sets a new password using a token from the reset
+// email and signs the account out of every existing session.
+func PasswordResetConfirmPost(c *gin.Context) {
+	var input PasswordResetConfirm
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Reset tokens are not tied to an identifier, so only the address is limited
+	if credentialBlocked(c, "reset", "") {
+		return
+	}
+
+	var reset models.PasswordReset
+	err := dbFor(c).Where("token_hash = ?", hashToken(strings.TrimSpace(input.Token))).First(&reset).Error
+	if err != nil || !resetUsable(reset, time.Now()) {
+		credentialFailed(c, "reset", "")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+		return
+	}
+
+	hashed, err := hashPassword(input.NewPassword)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+
+	// Claim the token first so it cannot be used twice
+	claim := dbFor(c).Model(&models.PasswordReset{}).Where("id = ? AND used_at IS NULL", reset.ID).Update("used_at", time.Now())
+	if claim.Error != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	if claim.RowsAffected == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+		return
+	}
+
+	var email, name string
+	if reset.Kind == "owner" {
+		var owner OwnerSchema
+		if err := dbFor(c).First(&owner, reset.PrincipalID).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+			return
+		}
+		if err := dbFor(c).Model(&owner).Update("password", hashed).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+			return
+		}
+		email, name = owner.Email, owner.OwnerName
+	} else {
+		var mentor MentorLogin
+		if err := dbFor(c).First(&mentor, reset.PrincipalID).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+			return
+		}
+		if err := dbFor(c).Model(&mentor).Update("password", hashed).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+			return
+		}
+		email, name = mentor.Email, mentor.MentorName
+	}
+
+	if err := revokeSessions(c, reset.Kind, reset.PrincipalID); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Password updated but failed to sign out existing sessions"})
+		return
+	}
+	sendEmail(email, notify.PasswordChanged, gin.H{"Name": name})
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"guidance/models"
+	"testing"
+	"time"
+)
+
+func TestResetUsable(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	used := now.Add(-time.Minute)
+
+	tests := []struct {
+		name  string
+		reset models.PasswordReset
+		want  bool
+	}{
+		{"fresh", models.PasswordReset{ExpiresAt: now.Add(passwordResetTTL)}, true},
+		{"already used", models.PasswordReset{ExpiresAt: now.Add(passwordResetTTL), UsedAt: &used}, false},
+		{"expired", models.PasswordReset{ExpiresAt: now.Add(-time.Second)}, false},
+		{"expires now", models.PasswordReset{ExpiresAt: now}, false},
+		{"used and expired", models.PasswordReset{ExpiresAt: now.Add(-time.Second), UsedAt: &used}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resetUsable(tt.reset, now); got != tt.want {
+				t.Errorf("resetUsable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResetTokenSingleUse(t *testing.T) {
+	now := time.Now()
+	reset := models.PasswordReset{ExpiresAt: now.Add(passwordResetTTL)}
+	if !resetUsable(reset, now) {
+		t.Fatal("new token is not usable")
+	}
+	// PasswordResetConfirmPost claims the token by setting UsedAt
+	reset.UsedAt = &now
+	if resetUsable(reset, now) {
+		t.Error("token is still usable after being claimed")
+	}
+}
+
+func TestResetToken(t *testing.T) {
+	a, err := newToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 64 || a == b {
+		t.Errorf("newToken returned %q and %q, want two distinct 64 character tokens", a, b)
+	}
+	if hashToken(a) == a || hashToken(a) != hashToken(a) {
+		t.Error("hashToken must be a stable digest that differs from the token")
+	}
+}
+
+func TestResetLink(t *testing.T) {
+	defer func(url string) { passwordResetURL = url }(passwordResetURL)
+
+	tests := []struct {
+		base string
+		want string
+	}{
+		{"https://example.com/reset-password", "https://example.com/reset-password?token=a%2Bb"},
+		{"https://example.com/reset?lang=en", "https://example.com/reset?lang=en&token=a%2Bb"},
+	}
+	for _, tt := range tests {
+		passwordResetURL = tt.base
+		if got := resetLink("a+b"); got != tt.want {
+			t.Errorf("resetLink with %s = %s, want %s", tt.base, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"errors"
+	"guidance/models"
+	"guidance/notify"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ratingWindowDays   = 90
+	minRatingsForAlert = 3
+)
+
+// ratingAlertThreshold is set from the config by Setup.
+var ratingAlertThreshold = 3.0
+
+// recentRating returns a mentor's average rating and count over the rating
+// window, optionally ignoring one rating.
+func recentRating(c *gin.Context, mentorID uint, exclude uint) (float64, int, error) {
+	var row struct {
+		Average float64
+		Count   int
+	}
+	err := dbFor(c).Model(&models.MentorRating{}).
+		Select("COALESCE(AVG(rating), 0) AS average, COUNT(*) AS count").
+		Where("mentor_id = ? AND id <> ? AND created_at >= ?", mentorID, exclude, time.Now().AddDate(0, 0, -ratingWindowDays)).
+		Scan(&row).Error
+	return row.Average, row.Count, err
+}
+
+// RatingPost records a student's rating of their mentor, either once per
+// month or once per completed session.
+func RatingPost(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+	var input RatingInput
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Rating < 1 || input.Rating > 5 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "rating must be between 1 and 5"})
+		return
+	}
+	if student.Mentor == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "No mentor has been assigned yet"})
+		return
+	}
+	var ment MentorSchema
+	if err := dbFor(c).Where("name = ?", student.Mentor).First(&ment).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to find assigned mentor"})
+		return
+	}
+
+	rating := models.MentorRating{MentorID: ment.ID, StudentID: student.ID, Rating: input.Rating, Comment: input.Comment}
+	var existing models.MentorRating
+	var err error
+	if input.SessionID != nil {
+		var session models.Session
+		if err := dbFor(c).Where("id = ? AND mentor_id = ? AND student_id = ?", *input.SessionID, ment.ID, student.ID).First(&session).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		if session.Status != models.SessionCompleted {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Only completed sessions can be rated"})
+			return
+		}
+		rating.SessionID = input.SessionID
+		err = dbFor(c).Where("session_id = ? AND student_id = ?", *input.SessionID, student.ID).First(&existing).Error
+	} else {
+		rating.Period = time.Now().Format("2006-01")
+		err = dbFor(c).Where("mentor_id = ? AND student_id = ? AND period = ?", ment.ID, student.ID, rating.Period).First(&existing).Error
+	}
+	if err == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "You have already rated your mentor for this period"})
+		return
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing rating"})
+		return
+	}
+
+	// The unique indexes settle two submissions racing past the check above
+	result := dbFor(c).Clauses(clause.OnConflict{DoNothing: true}).Create(&rating)
+	if result.Error != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "You have already rated your mentor for this period"})
+		return
+	}
+
+	checkRatingAlert(c, ment, rating)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Thank you for your feedback"})
+}
+
+// checkRatingAlert emails the owners when this rating pulls the mentor's
+// recent average below the threshold. It only fires on the crossing, not for
+// every further low rating.
+func checkRatingAlert(c *gin.Context, ment MentorSchema, rating models.MentorRating) {
+	average, count, err := recentRating(c, ment.ID, 0)
+	if err != nil || count < minRatingsForAlert || average >= ratingAlertThreshold {
+		return
+	}
+	before, beforeCount, err := recentRating(c, ment.ID, rating.ID)
+	if err != nil || (beforeCount >= minRatingsForAlert && before < ratingAlertThreshold) {
+		return
+	}
+
+	var owners []OwnerSchema
+	if err := dbFor(c).Find(&owners).Error; err != nil {
+		slog.Error("Failed to load owners for rating alert", "error", err)
+		return
+	}
+	for _, o := range owners {
+		sendEmail(o.Email, notify.RatingAlert, gin.H{
+			"Mentor":    ment.Name,
+			"Average":   average,
+			"Count":     count,
+			"Days":      ratingWindowDays,
+			"Threshold": ratingAlertThreshold,
+			"Comment":   rating.Comment,
+		})
+	}
+}
+
+// attachRatings fills in each mentor's average rating over the rating
+// window for the mentor listing.
+func attachRatings(c *gin.Context, mentors []MentorSchema) error {
+	var rows []struct {
+		MentorID uint
+		Average  float64
+		Count    int
+	}
+	err := dbFor(c).Model(&models.MentorRating{}).
+		Select("mentor_id, AVG(rating) AS average, COUNT(*) AS count").
+		Where("created_at >= ?", time.Now().AddDate(0, 0, -ratingWindowDays)).
+		Group("mentor_id").Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	byMentor := make(map[uint]int, len(rows))
+	for i, r := range rows {
+		byMentor[r.MentorID] = i
+	}
+	for i := range mentors {
+		if j, ok := byMentor[mentors[i].ID]; ok {
+			mentors[i].Rating = rows[j].Average
+			mentors[i].Ratings = rows[j].Count
+		}
+	}
+	return nil
+}
+
+// MentorRatingsGet lists the feedback left for a mentor, newest first.
+func MentorRatingsGet(c *gin.Context) {
+	var ratings []models.MentorRating
+	if err := dbFor(c).Where("mentor_id = ?", c.Param("id")).Order("created_at DESC").Limit(200).Find(&ratings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, ratings)
+}
+
+// MentorRatingTrend returns a mentor's average rating per month.
+func MentorRatingTrend(c *gin.Context) {
+	var trend []RatingTrendPoint
+	err := dbFor(c).Model(&models.MentorRating{}).
+		Select("to_char(date_trunc('month', created_at), 'YYYY-MM') AS month, AVG(rating) AS average, COUNT(*) AS count").
+		Where("mentor_id = ?", c.Param("id")).
+		Group("1").Order("1").Scan(&trend).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, trend)
+}
@@ -1,21 +1,23 @@
 package controllers
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"guidance/events"
+	"guidance/metrics"
 	"guidance/models"
-	"log"
+	"guidance/notify"
 	"net/http"
-	"os"
+	"net/url"
 	"sync"
 	"time"
 	// "encoding/json"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 	"github.com/razorpay/razorpay-go/utils"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type order struct {
@@ -28,53 +30,24 @@ type veri struct {
 	Sign    string `json:"razorpay_signature"`
 }
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Error loading .env file")
-	}
-
-	host := os.Getenv("DB_HOST")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbname := os.Getenv("DB_NAME")
-	port := os.Getenv("DB_PORT")
-
-	dsn := "host=" + host + " user=" + user + " password=" + password + " dbname=" + dbname + " port=" + port
+func Order(c *gin.Context) {
+	var inp map[string]interface{}
 
-	// Implement retry logic
-	var database *gorm.DB
-	var err error
-	maxRetries := 5
-	for i := 0; i < maxRetries; i++ {
-		database, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-		if err == nil {
-			break
-		}
-		log.Printf("Failed to connect to database (attempt %d/%d): %v", i+1, maxRetries, err)
-		time.Sleep(2 * time.Second) // Wait before retrying
-	}
+	// The signature covers the raw body, so it is checked before decoding
+	body, err := c.GetRawData()
 	if err != nil {
-		log.Fatalf("Failed to connect to database after %d attempts: %v", maxRetries, err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-
-	db1 = database
-
-	// Set the maximum number of open connections in the connection pool
-	sqlDB, err := db1.DB()
-	if err != nil {
-		log.Fatalf("Failed to get database connection: %v", err)
+	signature := c.GetHeader("X-Razorpay-Signature")
+	if signature == "" || !utils.VerifyWebhookSignature(string(body), signature, razorpayWebhookSecret) {
+		metrics.SignatureFailures.WithLabelValues("webhook").Inc()
+		logger(c).Warn("razorpay webhook signature did not verify")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid signature"})
+		return
 	}
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetConnMaxLifetime(time.Hour)
 
-	log.Println("Successfully connected to the database")
-}
-
-func Order(c *gin.Context) {
-	var inp map[string]interface{}
-
-	if err := c.ShouldBindJSON(&inp); err != nil {
+	if err := json.Unmarshal(body, &inp); err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -82,6 +55,9 @@ func Order(c *gin.Context) {
 	eve := inp["event"].(string)
 
 	if(eve!="payment.captured"){
+		if eve == "payment.failed" {
+			metrics.Payments.WithLabelValues("failed").Inc()
+		}
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "payment is failed"})
 		return
 	}
@@ -127,9 +103,38 @@ func Order(c *gin.Context) {
 	name := orderNotes["name"].(string)
 	phone := orderNotes["phone"].(string)
 
+	// Record the payment before the enrollment checks so revenue reports stay
+	// complete even when the student already exists
+	paymentID, _ := entity["id"].(string)
+	orderID, _ := entity["order_id"].(string)
+	currency, _ := entity["currency"].(string)
+	paise, _ := entity["amount"].(float64)
+	if paymentID != "" {
+		payment := models.Payment{
+			PaymentID:  paymentID,
+			OrderID:    orderID,
+			Amount:     int64(paise),
+			Currency:   currency,
+			Program:    program,
+			Name:       name,
+			Email:      email,
+			Phone:      phone,
+			Status:     "captured",
+			CapturedAt: time.Now(),
+		}
+		result := dbFor(c).Clauses(clause.OnConflict{DoNothing: true}).Create(&payment)
+		if result.Error != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save payment"})
+			return
+		}
+		// Razorpay retries webhooks, only the first delivery is counted
+		if result.RowsAffected == 1 {
+			metrics.Payments.WithLabelValues("captured").Inc()
+		}
+	}
+
 
-	fmt.Println("executed1")
-	fmt.Println(program)
+	logger(c).Info("payment captured", "paymentId", paymentID, "program", program)
 
 	var wg sync.WaitGroup
 	resultChan := make(chan int, 1)
@@ -143,8 +148,6 @@ func Order(c *gin.Context) {
 
 
 
-	fmt.Println("executed2")
-
 	if program=="Normal" {
 		input.Sub = "Normal"
 	} else {
@@ -158,12 +161,10 @@ func Order(c *gin.Context) {
 	today := time.Now()
 	input.Date = today.Format("2006-01-02") // Using the layout format "2006-01-02" for YYYY-MM-DD
 
-	fmt.Println("executed3")
-
 	go func(input User) {
 		defer wg.Done()
 		naam := UserSchema{}
-		if err := db1.Where("phone = ?", input.Phone).First(&naam).Error; err != nil {
+		if err := dbFor(c).Where("phone = ?", input.Phone).First(&naam).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				// No user found, it's safe to proceed with creating a new user
 				resultChan <- 1
@@ -181,12 +182,8 @@ func Order(c *gin.Context) {
 		close(resultChan)
 	}()
 
-	fmt.Println("executed4")
-	fmt.Println(input)
-
 	// Wait for the result from the goroutine
 	result := <-resultChan
-	fmt.Println(result)
 	if result == 2 {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Phone number already exists"})
 		return
@@ -196,32 +193,50 @@ func Order(c *gin.Context) {
 	}
 	// If user doesn't exist, proceed with saving the user
 	data := models.UserSchema{Name: input.Name, Phone: input.Phone, Email: input.Email, Date: input.Date, Class: input.Class, Sub: input.Sub, Mentor: input.Mentor}
-	if err := db1.Create(&data).Error; err != nil {
+	if err := dbFor(c).Create(&data).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
 		return
 	}
 
-	fmt.Println("executed5")
-
 	reuser := models.RenrollSchema{Name: input.Name, Phone: input.Phone, Email: input.Email, Date: input.Date, Class: input.Class, Sub: input.Sub, Mentor: "", Renrollment: 0}
-	if err := db1.Create(&reuser).Error; err != nil {
+	if err := dbFor(c).Create(&reuser).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
 		return
 	}
 
-	fmt.Println("executed6")
-
-	fmt.Println(class)
-	fmt.Println(name)
-	fmt.Println(email)
-	fmt.Println(phone)
-	fmt.Println(today)
+	amount := ""
+	if paise > 0 {
+		amount = fmt.Sprintf("%.2f", paise/100)
+	}
+	sendEmail(data.Email, notify.Welcome, data)
+	sendEmail(data.Email, notify.PaymentReceipt, gin.H{
+		"Name":      data.Name,
+		"Sub":       data.Sub,
+		"Amount":    amount,
+		"PaymentID": paymentID,
+		"Date":      data.Date,
+	})
+
+	events.Publish(events.StudentCreated, events.Student{
+		ID: data.ID, Name: data.Name, Phone: data.Phone, Email: data.Email, Date: data.Date,
+		Class: data.Class, Sub: data.Sub, Mentor: data.Mentor, Expired: data.Expired,
+	})
+	events.Publish(events.PaymentCaptured, gin.H{
+		"paymentId": paymentID,
+		"amount":    amount,
+		"program":   program,
+		"name":      data.Name,
+		"email":     data.Email,
+		"phone":     data.Phone,
+	})
+
+	logger(c).Info("student enrolled from payment", "studentId", data.ID, "paymentId", paymentID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "User data saved successfully"})
 }
 
 func Key(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"key": "rzp_test_gAnipV9pamMXV2"})
+	c.JSON(http.StatusOK, gin.H{"key": razorpayKeyID})
 }
 
 func Verify(c *gin.Context) {
@@ -232,18 +247,20 @@ func Verify(c *gin.Context) {
 		return
 	}
 
-	// client := razorpay.NewClient("rzp_test_gAnipV9pamMXV2", "cUhcdokPA3QwiULcMmadGx86")
-
 	params := map[string]interface{}{
 		"razorpay_order_id":   input.Orderid,
 		"razorpay_payment_id": input.Payid,
 	}
 
 	signature := input.Sign
-	secret := "cUhcdokPA3QwiULcMmadGx86"
-	utils.VerifyPaymentSignature(params, signature, secret)
+	if !utils.VerifyPaymentSignature(params, signature, razorpayKeySecret) {
+		metrics.SignatureFailures.WithLabelValues("checkout").Inc()
+		logger(c).Warn("razorpay signature did not verify", "paymentId", input.Payid)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid signature"})
+		return
+	}
 
-	redirectURL := fmt.Sprintf("http://localhost:3000/razor?reference=%v", input.Payid)
+	redirectURL := fmt.Sprintf("%s?reference=%v", razorpayRedirectURL, url.QueryEscape(input.Payid))
 	c.Redirect(http.StatusFound, redirectURL)
 
 	// c.JSON(http.StatusOK, gin.H{"message": "payment success"})
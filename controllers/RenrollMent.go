@@ -1,68 +1,21 @@
 package controllers
 
 import (
-	"fmt"
+	"guidance/events"
 	"guidance/models"
-	"log"
 	"net/http"
-	"os"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Error loading .env file")
-	}
-
-	host := os.Getenv("DB_HOST")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbname := os.Getenv("DB_NAME")
-	port := os.Getenv("DB_PORT")
-
-	dsn := "host=" + host + " user=" + user + " password=" + password + " dbname=" + dbname + " port=" + port
-
-	// Implement retry logic
-	var database *gorm.DB
-	var err error
-	maxRetries := 5
-	for i := 0; i < maxRetries; i++ {
-		database, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-		if err == nil {
-			break
-		}
-		log.Printf("Failed to connect to database (attempt %d/%d): %v", i+1, maxRetries, err)
-		time.Sleep(2 * time.Second) // Wait before retrying
-	}
-	if err != nil {
-		log.Fatalf("Failed to connect to database after %d attempts: %v", maxRetries, err)
-	}
-
-	db4 = database
-
-	// Set the maximum number of open connections in the connection pool
-	sqlDB, err := db4.DB()
-	if err != nil {
-		log.Fatalf("Failed to get database connection: %v", err)
-	}
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetConnMaxLifetime(time.Hour)
-
-	log.Println("Successfully connected to the database")
-}
-
 func RenrollDataGet(c *gin.Context) {
 	var wg sync.WaitGroup
 
 	// Query the database to get all users
-	rows, err := db4.Model(&RenrollSchema{}).Rows()
+	rows, err := dbFor(c).Model(&RenrollSchema{}).Rows()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -73,7 +26,7 @@ func RenrollDataGet(c *gin.Context) {
 	var userSchemas []RenrollSchema
 	for rows.Next() {
 		var user RenrollSchema
-		if err := db4.ScanRows(rows, &user); err != nil {
+		if err := dbFor(c).ScanRows(rows, &user); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -114,27 +67,23 @@ func RenrollDataPost(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	fmt.Println(input)
 
 	var dte RenrollSchema
-	if err := db4.Where("phone=?", input.Phone).First(&dte).Error; err != nil {
+	if err := dbFor(c).Where("phone=?", input.Phone).First(&dte).Error; err != nil {
 		// c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to Find existing user with this Name"})
 		// return
 	}
-	fmt.Println(dte)
 
 	if dte.Date != "" {
 		// Parse the string date into a time.Time value
 		prevDate, err := time.Parse("2006-01-02", dte.Date) // Assuming the date format is "YYYY-MM-DD"
 		if err != nil {
-			fmt.Println("done1")
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse re-enrollment date"})
 			return
 		}
 
 		newDate, err := time.Parse("2006-01-02", input.Date) // Assuming the date format is "YYYY-MM-DD"
 		if err != nil {
-			fmt.Println("done1")
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse re-enrollment date"})
 			return
 		}
@@ -144,14 +93,38 @@ func RenrollDataPost(c *gin.Context) {
 		diffInDays := int(duration.Hours() / 24)
 
 		if diffInDays < 30 {
-			fmt.Println("done")
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "A re-enrollment for this phone number has already been done within the last 30 days."})
 			return
 		}
 	}
 
+	// Reviving an expired student takes a slot with their mentor, so it needs
+	// an owner or a payment captured since the student last enrolled.
+	var student UserSchema
+	revive := dbFor(c).Where("phone = ? AND expired = ?", input.Phone, true).First(&student).Error == nil
+	if revive && !hasOwnerSession(c) {
+		since := student.Date
+		if dte.Date != "" {
+			since = dte.Date
+		}
+		query := dbFor(c).Model(&models.Payment{}).Where("phone = ? AND status = ?", input.Phone, "captured")
+		if since != "" {
+			query = query.Where("captured_at >= CAST(? AS date)", since)
+		}
+		var paid int64
+		if err := query.Count(&paid).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if paid == 0 {
+			c.AbortWithStatusJSON(http.StatusPaymentRequired, gin.H{"error": "No payment found for this re-enrollment"})
+			return
+		}
+	}
+
+	var renrolled interface{}
 	var existingUser RenrollSchema
-	if err := db4.Where("name=?", input.Name).First(&existingUser).Error; err != nil {
+	if err := dbFor(c).Where("name=?", input.Name).First(&existingUser).Error; err != nil {
 		// data := models.UserSchema{Name: input.Name, Phone: input.Phone, Email: input.Email, Date: input.Date, Class: input.Class, Sub: input.Sub, Mentor: input.Mentor}
 		// if err := db4.Create(&data).Error; err != nil {
 		// 	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
@@ -159,10 +132,11 @@ func RenrollDataPost(c *gin.Context) {
 		// }
 
 		reuser := models.RenrollSchema{Name: input.Name, Phone: input.Phone, Email: input.Email, Date: input.Date, Class: input.Class, Sub: input.Sub, Mentor: input.Mentor, Renrollment: 1}
-		if err := db4.Create(&reuser).Error; err != nil {
+		if err := dbFor(c).Create(&reuser).Error; err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
 			return
 		}
+		renrolled = reuser
 
 	} else {
 		existingUser.Phone = input.Phone
@@ -173,12 +147,44 @@ func RenrollDataPost(c *gin.Context) {
 		existingUser.Mentor = input.Mentor
 		existingUser.Renrollment = existingUser.Renrollment + 1
 
-		if err := db4.Save(&existingUser).Error; err != nil {
+		if err := dbFor(c).Save(&existingUser).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		renrolled = existingUser
+	}
+
+	// A re-enrollment brings an expired student back onto their mentor's
+	// active count. When the mentor has filled the slot in the meantime the
+	// student goes back to the unassigned list for the owner to place.
+	if revive {
+		err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+			student.Expired = false
+			if student.Mentor != "" {
+				result := tx.Model(&MentorSchema{}).Where("name = ? AND onn < handle", student.Mentor).Update("onn", gorm.Expr("onn + 1"))
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected == 0 {
+					student.Mentor = ""
+				}
+			}
+			return tx.Save(&student).Error
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 	}
 
+	history := models.ReenrollmentLog{Name: input.Name, Phone: input.Phone, Date: input.Date, Class: input.Class, Sub: input.Sub, Mentor: input.Mentor}
+	if err := dbFor(c).Create(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	events.Publish(events.StudentReenrolled, renrolled)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Renrolled successfully"})
 
 }
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"guidance/jobs"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validDate matches the YYYY-MM-DD strings stored in the date columns that
+// are real calendar dates, leap days included, so malformed rows are skipped
+// instead of failing the cast.
+const validDate = `'^(\d{4}-(0[13578]|1[02])-(0[1-9]|[12]\d|3[01])|\d{4}-(0[469]|11)-(0[1-9]|[12]\d|30)|\d{4}-02-(0[1-9]|1\d|2[0-8])|(\d\d(0[48]|[2468][048]|[13579][26])|([02468][048]|[13579][26])00)-02-29)$'`
+
+var reportPeriods = map[string]bool{"day": true, "week": true, "month": true}
+
+// reportPeriod reads ?period, defaulting to day. The value is interpolated
+// into date_trunc, so only whitelisted values are accepted.
+func reportPeriod(c *gin.Context) (string, bool) {
+	period := c.DefaultQuery("period", "day")
+	if !reportPeriods[period] {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "period must be day, week or month"})
+		return "", false
+	}
+	return period, true
+}
+
+// writeReport sends rows as CSV when ?format=csv, otherwise value as JSON.
+func writeReport(c *gin.Context, name string, header []string, rows [][]string, value interface{}) {
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, value)
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+	c.Status(http.StatusOK)
+	w := csv.NewWriter(c.Writer)
+	w.Write(header)
+	w.WriteAll(rows)
+}
+
+// EnrollmentReport counts new enrollments and re-enrollments per period,
+// split by class and plan.
+func EnrollmentReport(c *gin.Context) {
+	from, to, ok := dateRange(c, 30)
+	if !ok {
+		return
+	}
+	period, ok := reportPeriod(c)
+	if !ok {
+		return
+	}
+
+	var report []EnrollmentReportRow
+	err := dbFor(c).Raw(`WITH entries AS (
+			SELECT date::date AS day, class, sub, 1 AS enrolled, 0 AS reenrolled
+			FROM user_schemas WHERE date ~ `+validDate+`
+			UNION ALL
+			SELECT date::date, class, sub, 0, 1
+			FROM reenrollment_logs WHERE date ~ `+validDate+`
+		)
+		SELECT to_char(date_trunc('`+period+`', day), 'YYYY-MM-DD') AS period, class, sub,
+			SUM(enrolled) AS enrollments, SUM(reenrolled) AS reenrollments
+		FROM entries
+		WHERE day >= CAST(? AS date) AND day < CAST(? AS date)
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 2, 3`, from.Format("2006-01-02"), to.Format("2006-01-02")).Scan(&report).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows := make([][]string, 0, len(report))
+	for _, r := range report {
+		rows = append(rows, []string{r.Period, r.Class, r.Sub, strconv.Itoa(r.Enrollments), strconv.Itoa(r.Reenrollments)})
+	}
+	writeReport(c, "enrollments", []string{"period", "class", "sub", "enrollments", "reenrollments"}, rows, report)
+}
+
+// RevenueReport sums captured payments per period and plan. Amounts are in
+// rupees.
+func RevenueReport(c *gin.Context) {
+	from, to, ok := dateRange(c, 30)
+	if !ok {
+		return
+	}
+	period, ok := reportPeriod(c)
+	if !ok {
+		return
+	}
+
+	var report []RevenueReportRow
+	err := dbFor(c).Raw(`SELECT to_char(date_trunc('`+period+`', captured_at), 'YYYY-MM-DD') AS period,
+			program AS plan, COUNT(*) AS payments, SUM(amount) / 100.0 AS amount
+		FROM payments
+		WHERE status = 'captured' AND captured_at >= ? AND captured_at < ?
+		GROUP BY 1, 2
+		ORDER BY 1, 2`, from, to).Scan(&report).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows := make([][]string, 0, len(report))
+	for _, r := range report {
+		rows = append(rows, []string{r.Period, r.Plan, strconv.Itoa(r.Payments), strconv.FormatFloat(r.Amount, 'f', 2, 64)})
+	}
+	writeReport(c, "revenue", []string{"period", "plan", "payments", "amount"}, rows, report)
+}
+
+// RenewalReport looks at every plan period that ended in the range. A period
+// counts as renewed when the same phone started a later period, churned
+// when it ended without one, and pending while it has not ended yet.
+func RenewalReport(c *gin.Context) {
+	from, to, ok := dateRange(c, 30)
+	if !ok {
+		return
+	}
+
+	report := RenewalSummary{From: from.Format("2006-01-02"), To: to.AddDate(0, 0, -1).Format("2006-01-02")}
+	err := dbFor(c).Raw(`WITH periods AS (
+			SELECT phone, date::date AS start FROM user_schemas WHERE date ~ `+validDate+`
+			UNION ALL
+			SELECT phone, date::date FROM reenrollment_logs WHERE date ~ `+validDate+`
+		), due AS (
+			SELECT p.start + CAST(? AS integer) AS ends,
+				EXISTS (SELECT 1 FROM periods n WHERE n.phone = p.phone AND n.start > p.start) AS renewed
+			FROM periods p
+			WHERE p.start + CAST(? AS integer) >= CAST(? AS date) AND p.start + CAST(? AS integer) < CAST(? AS date)
+		)
+		SELECT COUNT(*) AS due,
+			COUNT(*) FILTER (WHERE renewed) AS renewed,
+			COUNT(*) FILTER (WHERE NOT renewed AND ends < CAST(? AS date)) AS churned,
+			COUNT(*) FILTER (WHERE NOT renewed AND ends >= CAST(? AS date)) AS pending
+		FROM due`,
+		jobs.PlanDays, jobs.PlanDays, report.From, jobs.PlanDays, to.Format("2006-01-02"),
+		time.Now().Format("2006-01-02"), time.Now().Format("2006-01-02")).Scan(&report).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if report.Due > 0 {
+		report.RenewalRate = float64(report.Renewed) / float64(report.Due)
+		report.ChurnRate = float64(report.Churned) / float64(report.Due)
+	}
+
+	rows := [][]string{{
+		report.From, report.To,
+		strconv.Itoa(report.Due), strconv.Itoa(report.Renewed), strconv.Itoa(report.Churned), strconv.Itoa(report.Pending),
+		strconv.FormatFloat(report.RenewalRate, 'f', 4, 64), strconv.FormatFloat(report.ChurnRate, 'f', 4, 64),
+	}}
+	writeReport(c, "renewals", []string{"from", "to", "due", "renewed", "churned", "pending", "renewal_rate", "churn_rate"}, rows, report)
+}
+
+// MentorPerformanceReport summarises each mentor's capacity and load next to
+// how their students fared: how many re-enrolled, how many were lost to
+// expiry and how long they stayed on average. Expired students count until
+// the end of their last paid period, active ones until today. Students counts
+// everyone the mentor has had, found from current assignments, re-enrollment
+// history and session logs; the other figures cover current students.
+func MentorPerformanceReport(c *gin.Context) {
+	var report []MentorPerformanceRow
+	err := dbFor(c).Raw(`WITH latest AS (
+			SELECT phone, MAX(date::date) AS start FROM (
+				SELECT phone, date FROM reenrollment_logs WHERE date ~ `+validDate+`
+				UNION ALL
+				SELECT phone, date FROM renroll_schemas WHERE renrollment > 0 AND date ~ `+validDate+`
+			) r
+			GROUP BY phone
+		), students AS (
+			SELECT u.mentor, u.expired, u.date::date AS joined, l.start AS renewed_at
+			FROM user_schemas u
+			LEFT JOIN latest l ON l.phone = u.phone
+			WHERE u.mentor <> '' AND u.date ~ `+validDate+`
+		), history AS (
+			SELECT mentor, id AS student_id FROM user_schemas WHERE mentor <> ''
+			UNION
+			SELECT r.mentor, u.id FROM reenrollment_logs r JOIN user_schemas u ON u.phone = r.phone WHERE r.mentor <> ''
+			UNION
+			SELECT m.name, l.student_id FROM session_logs l JOIN mentor_schemas m ON m.id = l.mentor_id
+		)
+		SELECT m.id AS mentor_id, m.name, m.college, m.handle, m.onn, m.total,
+			(SELECT COUNT(*) FROM history h WHERE h.mentor = m.name) AS students,
+			COUNT(*) FILTER (WHERE s.renewed_at > s.joined) AS reenrolled,
+			COUNT(*) FILTER (WHERE s.expired) AS lost,
+			COALESCE(AVG(CASE WHEN s.expired
+				THEN GREATEST(s.joined, COALESCE(s.renewed_at, s.joined)) + CAST(? AS integer)
+				ELSE CURRENT_DATE END - s.joined), 0) AS average_tenure
+		FROM mentor_schemas m
+		LEFT JOIN students s ON s.mentor = m.name
+		GROUP BY m.id
+		ORDER BY m.name`, jobs.PlanDays).Scan(&report).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows := make([][]string, 0, len(report))
+	for i := range report {
+		r := &report[i]
+		r.Spare = r.Handle - r.Onn
+		if r.Handle > 0 {
+			r.LoadPercent = float64(r.Onn) / float64(r.Handle) * 100
+		}
+		if r.Reenrolled+r.Lost > 0 {
+			r.RetentionRate = float64(r.Reenrolled) / float64(r.Reenrolled+r.Lost)
+		}
+		rows = append(rows, []string{
+			r.Name, r.College,
+			strconv.Itoa(r.Handle), strconv.Itoa(r.Onn), strconv.Itoa(r.Total), strconv.Itoa(r.Spare),
+			strconv.FormatFloat(r.LoadPercent, 'f', 1, 64),
+			strconv.Itoa(r.Students), strconv.Itoa(r.Reenrolled), strconv.Itoa(r.Lost),
+			strconv.FormatFloat(r.RetentionRate, 'f', 4, 64),
+			strconv.FormatFloat(r.AverageTenure, 'f', 1, 64),
+		})
+	}
+	writeReport(c, "mentors", []string{"name", "college", "handle", "on", "total", "spare", "load_percent", "students", "reenrolled", "lost", "retention_rate", "average_tenure_days"}, rows, report)
+}
@@ -0,0 +1,340 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"guidance/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var sessionModes = map[string]bool{"online": true, "offline": true, "call": true}
+
+const (
+	minSessionMinutes = 15
+	maxSessionMinutes = 240
+)
+
+// assignedStudent loads the student with the given id and checks they are
+// currently assigned to ment, writing the error response when not.
+func assignedStudent(c *gin.Context, ment MentorSchema, id uint) (UserSchema, bool) {
+	var student UserSchema
+	if err := dbFor(c).First(&student, id).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return student, false
+	}
+	if student.Mentor != ment.Name || student.Expired {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Student is not assigned to this mentor"})
+		return student, false
+	}
+	return student, true
+}
+
+var errSlotTaken = errors.New("mentor already has a session at this time")
+
+// hasConflict reports whether the mentor already has a live session
+// overlapping [start, start+duration). exclude skips the session being
+// rescheduled.
+func hasConflict(tx *gorm.DB, mentorID uint, start time.Time, duration int, exclude uint) (bool, error) {
+	end := start.Add(time.Duration(duration) * time.Minute)
+	var count int64
+	err := tx.Model(&models.Session{}).
+		Where("mentor_id = ? AND status = ? AND id <> ?", mentorID, models.SessionScheduled, exclude).
+		Where("scheduled_at < ? AND scheduled_at + duration * interval '1 minute' > ?", end, start).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// bookSlot runs save in a transaction once the slot is known to be free,
+// returning errSlotTaken otherwise. The mentor's row is locked first, so two
+// bookings for the same mentor cannot both pass the check.
+func bookSlot(c *gin.Context, mentorID uint, start time.Time, duration int, exclude uint, save func(tx *gorm.DB) error) error {
+	return dbFor(c).Transaction(func(tx *gorm.DB) error {
+		var ment MentorSchema
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&ment, mentorID).Error; err != nil {
+			return err
+		}
+		conflict, err := hasConflict(tx, mentorID, start, duration, exclude)
+		if err != nil {
+			return err
+		}
+		if conflict {
+			return errSlotTaken
+		}
+		return save(tx)
+	})
+}
+
+func parseSessionTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, errors.New("scheduledAt must be an RFC3339 timestamp")
+	}
+	return t.UTC(), nil
+}
+
+func validDuration(d int) bool {
+	return d >= minSessionMinutes && d <= maxSessionMinutes
+}
+
+func SessionPost(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+
+	var input SessionInput
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	start, err := parseSessionTime(input.ScheduledAt)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validDuration(input.Duration) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("duration must be between %d and %d minutes", minSessionMinutes, maxSessionMinutes)})
+		return
+	}
+	if !sessionModes[input.Mode] {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "mode must be one of online, offline or call"})
+		return
+	}
+	if start.Before(time.Now()) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "session must be scheduled in the future"})
+		return
+	}
+
+	var student UserSchema
+	if err := dbFor(c).First(&student, input.StudentID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+	if student.Mentor != ment.Name || student.Expired {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Student is not assigned to this mentor"})
+		return
+	}
+
+	session := models.Session{
+		MentorID:    ment.ID,
+		StudentID:   student.ID,
+		ScheduledAt: start,
+		Duration:    input.Duration,
+		Mode:        input.Mode,
+		Status:      models.SessionScheduled,
+	}
+	err = bookSlot(c, ment.ID, start, input.Duration, 0, func(tx *gorm.DB) error {
+		return tx.Create(&session).Error
+	})
+	if errors.Is(err, errSlotTaken) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Mentor already has a session at this time"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session scheduled successfully", "session": session})
+}
+
+// MentorSessionsGet lists a mentor's sessions, upcoming first. Pass
+// ?all=true to include past and cancelled sessions.
+func MentorSessionsGet(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+
+	query := dbFor(c).Where("mentor_id = ?", ment.ID)
+	if c.Query("all") != "true" {
+		query = query.Where("status = ? AND scheduled_at >= ?", models.SessionScheduled, time.Now().Add(-24*time.Hour))
+	}
+	var sessions []models.Session
+	if err := query.Order("scheduled_at").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// mentorSession loads the :id session and checks it belongs to the signed
+// in mentor, who is returned alongside it.
+func mentorSession(c *gin.Context) (MentorSchema, models.Session, bool) {
+	var session models.Session
+	ment, ok := currentMentor(c)
+	if !ok {
+		return ment, session, false
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return ment, session, false
+	}
+	if err := dbFor(c).Where("id = ? AND mentor_id = ?", id, ment.ID).First(&session).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return ment, session, false
+	}
+	return ment, session, true
+}
+
+func SessionReschedulePost(c *gin.Context) {
+	ment, session, ok := mentorSession(c)
+	if !ok {
+		return
+	}
+	if session.Status != models.SessionScheduled {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Only scheduled sessions can be rescheduled"})
+		return
+	}
+	// The student may have been reassigned or expired since booking
+	if _, ok := assignedStudent(c, ment, session.StudentID); !ok {
+		return
+	}
+
+	var input SessionReschedule
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	start, err := parseSessionTime(input.ScheduledAt)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if start.Before(time.Now()) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "session must be scheduled in the future"})
+		return
+	}
+	duration := session.Duration
+	if input.Duration != 0 {
+		if !validDuration(input.Duration) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("duration must be between %d and %d minutes", minSessionMinutes, maxSessionMinutes)})
+			return
+		}
+		duration = input.Duration
+	}
+
+	session.ScheduledAt = start
+	session.Duration = duration
+	err = bookSlot(c, session.MentorID, start, duration, session.ID, func(tx *gorm.DB) error {
+		return tx.Save(&session).Error
+	})
+	if errors.Is(err, errSlotTaken) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Mentor already has a session at this time"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session rescheduled successfully", "session": session})
+}
+
+func SessionCancelPost(c *gin.Context) {
+	_, session, ok := mentorSession(c)
+	if !ok {
+		return
+	}
+	if session.Status != models.SessionScheduled {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Only scheduled sessions can be cancelled"})
+		return
+	}
+	session.Status = models.SessionCancelled
+	if err := dbFor(c).Save(&session).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session cancelled successfully"})
+}
+
+func MentorSessionsICS(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+	var sessions []models.Session
+	if err := dbFor(c).Where("mentor_id = ?", ment.ID).Order("scheduled_at").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Summaries name the student, so load them in one go
+	ids := make([]uint, 0, len(sessions))
+	for _, s := range sessions {
+		ids = append(ids, s.StudentID)
+	}
+	var students []UserSchema
+	if len(ids) > 0 {
+		if err := dbFor(c).Where("id IN ?", ids).Find(&students).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	names := make(map[uint]string, len(students))
+	for _, s := range students {
+		names[s.ID] = s.Name
+	}
+
+	writeICS(c, fmt.Sprintf("mentor-%d", ment.ID), sessions, func(s models.Session) string {
+		return "Mentoring session with " + names[s.StudentID]
+	})
+}
+
+func StudentSessionsICS(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+	var sessions []models.Session
+	if err := dbFor(c).Where("student_id = ?", student.ID).Order("scheduled_at").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	mentor := student.Mentor
+	writeICS(c, fmt.Sprintf("student-%d", student.ID), sessions, func(models.Session) string {
+		return "Mentoring session with " + mentor
+	})
+}
+
+// writeICS renders sessions as an RFC 5545 calendar. Cancelled sessions are
+// kept with STATUS:CANCELLED so subscribed calendars drop them.
+func writeICS(c *gin.Context, name string, sessions []models.Session, summary func(models.Session) string) {
+	const layout = "20060102T150405Z"
+	var b strings.Builder
+	line := func(s string) { b.WriteString(s + "\r\n") }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//JEE Simplified//Guidance//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	for _, s := range sessions {
+		status := "CONFIRMED"
+		if s.Status == models.SessionCancelled {
+			status = "CANCELLED"
+		}
+		line("BEGIN:VEVENT")
+		line(fmt.Sprintf("UID:session-%d@jeesimplified", s.ID))
+		line("DTSTAMP:" + s.UpdatedAt.UTC().Format(layout))
+		line("DTSTART:" + s.ScheduledAt.UTC().Format(layout))
+		line("DTEND:" + s.ScheduledAt.Add(time.Duration(s.Duration)*time.Minute).UTC().Format(layout))
+		line("SUMMARY:" + icsEscape(summary(s)))
+		line("DESCRIPTION:" + icsEscape("Mode: "+s.Mode))
+		line("STATUS:" + status)
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".ics"))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(b.String()))
+}
+
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"errors"
+	"guidance/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errSessionLogged = errors.New("session has already been logged or cancelled")
+
+// SessionLogPost records the outcome of a session. The log can point at a
+// scheduled session, which is then marked completed, or stand alone for
+// sessions that happened outside the scheduler.
+func SessionLogPost(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+
+	var input SessionLogInput
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Attendance != models.Attended && input.Attendance != models.NoShow {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "attendance must be attended or no_show"})
+		return
+	}
+	if input.Duration < 0 || input.Duration > maxSessionMinutes {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "duration is out of range"})
+		return
+	}
+
+	student, ok := assignedStudent(c, ment, input.StudentID)
+	if !ok {
+		return
+	}
+
+	heldAt := time.Now().UTC()
+	if input.HeldAt != "" {
+		t, err := time.Parse(time.RFC3339, input.HeldAt)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "heldAt must be an RFC3339 timestamp"})
+			return
+		}
+		heldAt = t.UTC()
+	}
+
+	var session models.Session
+	if input.SessionID != nil {
+		if err := dbFor(c).Where("id = ? AND mentor_id = ? AND student_id = ?", *input.SessionID, ment.ID, student.ID).First(&session).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		if session.Status != models.SessionScheduled {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Session has already been logged or cancelled"})
+			return
+		}
+		if input.HeldAt == "" {
+			heldAt = session.ScheduledAt
+		}
+		if input.Duration == 0 && input.Attendance == models.Attended {
+			input.Duration = session.Duration
+		}
+	}
+	if input.Attendance == models.NoShow {
+		input.Duration = 0
+	}
+
+	entry := models.SessionLog{
+		SessionID:  input.SessionID,
+		MentorID:   ment.ID,
+		StudentID:  student.ID,
+		Attendance: input.Attendance,
+		Duration:   input.Duration,
+		Topics:     input.Topics,
+		Notes:      input.Notes,
+		HeldAt:     heldAt,
+	}
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if input.SessionID != nil {
+			res := tx.Model(&models.Session{}).
+				Where("id = ? AND status = ?", session.ID, models.SessionScheduled).
+				Update("status", models.SessionCompleted)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return errSessionLogged
+			}
+		}
+		return tx.Create(&entry).Error
+	})
+	if errors.Is(err, errSessionLogged) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Session has already been logged or cancelled"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session logged successfully", "log": entry})
+}
+
+// StudentLogsGet returns the signed in mentor's logs for one of their
+// current students, notes included. Logs written by a previous mentor are
+// not shown, and a mentor loses access once the student is reassigned.
+func StudentLogsGet(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+	id, ok := paramID(c, "id", "student")
+	if !ok {
+		return
+	}
+	student, ok := assignedStudent(c, ment, id)
+	if !ok {
+		return
+	}
+	var logs []models.SessionLog
+	if err := dbFor(c).Where("mentor_id = ? AND student_id = ?", ment.ID, student.ID).Order("held_at DESC").Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, logs)
+}
+
+// AttendanceGet reports per mentor attendance between ?from and ?to
+// (YYYY-MM-DD, default the last 30 days) next to their capacity, so owners
+// can size Handle on actual activity. Private notes are never included.
+func AttendanceGet(c *gin.Context) {
+	from, to, ok := dateRange(c, 30)
+	if !ok {
+		return
+	}
+
+	var report []MentorAttendance
+	err := dbFor(c).Raw(`SELECT m.id AS mentor_id, m.name, m.handle, m.onn,
+			COUNT(l.id) AS logged,
+			COUNT(l.id) FILTER (WHERE l.attendance = ?) AS attended,
+			COUNT(l.id) FILTER (WHERE l.attendance = ?) AS no_shows,
+			COALESCE(SUM(l.duration), 0) AS minutes,
+			COUNT(DISTINCT l.student_id) AS students
+		FROM mentor_schemas m
+		LEFT JOIN session_logs l ON l.mentor_id = m.id AND l.held_at >= ? AND l.held_at < ?
+		GROUP BY m.id
+		ORDER BY m.name`, models.Attended, models.NoShow, from, to).Scan(&report).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for i := range report {
+		if report[i].Logged > 0 {
+			report[i].AttendanceRate = float64(report[i].Attended) / float64(report[i].Logged)
+		}
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// dateRange parses the ?from and ?to query parameters as inclusive
+// YYYY-MM-DD dates and returns [from, to+1day). Missing values default to
+// the last defaultDays days.
+func dateRange(c *gin.Context, defaultDays int) (time.Time, time.Time, bool) {
+	now := time.Now().UTC()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	from := to.AddDate(0, 0, -defaultDays)
+
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "from must be YYYY-MM-DD"})
+			return from, to, false
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "to must be YYYY-MM-DD"})
+			return from, to, false
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return from, to, false
+	}
+	return from, to, true
+}
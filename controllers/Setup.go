@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"guidance/blob"
+	"guidance/config"
+	"guidance/logging"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Set from the config by Setup.
+var (
+	razorpayKeyID         string
+	razorpayKeySecret     string
+	razorpayWebhookSecret string
+	razorpayRedirectURL   string
+)
+
+// dbFor returns the shared pool bound to the request's context, so queries
+// are traced as part of the request and stop when the client goes away.
+func dbFor(c *gin.Context) *gorm.DB {
+	return db1.WithContext(c.Request.Context())
+}
+
+// paramID parses the named path parameter as a row id, answering 400 when
+// it is not one. Ids must never reach First as strings, which GORM would
+// take as raw SQL.
+func paramID(c *gin.Context, name, what string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid " + what + " id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// logger returns the request's logger, tagged with its request id.
+func logger(c *gin.Context) *slog.Logger {
+	return logging.FromContext(c.Request.Context())
+}
+
+// Setup hands the handlers the shared database pool and their settings. It
+// must be called before the routes are served.
+func Setup(db *gorm.DB, cfg config.Config) {
+	db1, db2, db3, db4, db5 = db, db, db, db, db
+
+	razorpayKeyID = cfg.Razorpay.KeyID
+	razorpayKeySecret = cfg.Razorpay.KeySecret
+	razorpayWebhookSecret = cfg.Razorpay.WebhookSecret
+	razorpayRedirectURL = cfg.Razorpay.RedirectURL
+
+	passwordResetURL = cfg.Auth.PasswordResetURL
+	totpIssuer = cfg.Auth.TOTPIssuer
+	requireOwner2FA = cfg.Auth.RequireOwner2FA
+
+	ticketSLA = time.Duration(cfg.Tickets.SLAHours) * time.Hour
+	ratingAlertThreshold = cfg.Ratings.AlertThreshold
+	blobs = blob.NewStore(cfg.Blob)
+	metricsToken = cfg.Metrics.Token
+}
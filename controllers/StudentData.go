@@ -1,65 +1,21 @@
 package controllers
 
 import (
-	"log"
+	"errors"
+	"guidance/events"
+	"guidance/notify"
 	"net/http"
-	"os"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Error loading .env file")
-	}
-
-	host := os.Getenv("DB_HOST")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbname := os.Getenv("DB_NAME")
-	port := os.Getenv("DB_PORT")
-
-	dsn := "host=" + host + " user=" + user + " password=" + password + " dbname=" + dbname + " port=" + port
-
-	// Implement retry logic
-	var database *gorm.DB
-	var err error
-	maxRetries := 5
-	for i := 0; i < maxRetries; i++ {
-		database, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-		if err == nil {
-			break
-		}
-		log.Printf("Failed to connect to database (attempt %d/%d): %v", i+1, maxRetries, err)
-		time.Sleep(2 * time.Second) // Wait before retrying
-	}
-	if err != nil {
-		log.Fatalf("Failed to connect to database after %d attempts: %v", maxRetries, err)
-	}
-
-	db3 = database
-
-	// Set the maximum number of open connections in the connection pool
-	sqlDB, err := db3.DB()
-	if err != nil {
-		log.Fatalf("Failed to get database connection: %v", err)
-	}
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetConnMaxLifetime(time.Hour)
-
-	log.Println("Successfully connected to the database")
-}
+var errMentorFull = errors.New("mentor has no free slot")
 
 func MentorUpdate(c *gin.Context) {
 	phone := c.Param("phone")
 
 	var user UserSchema
-	var ment MentorSchema
 	var newment MentorSchema
 	var body Student
 
@@ -67,25 +23,21 @@ func MentorUpdate(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := db3.Where("phone = ?", phone).First(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	if err := db3.Where("name = ?", user.Mentor).First(&ment).Error; err != nil {
+	if err := dbFor(c).Where("phone = ?", phone).First(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := db3.Where("name = ?", body.NewMentor).First(&newment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	// Editing a student's details without moving them leaves the mentors'
+	// counts alone and sends no assignment message
+	changed := body.NewMentor != user.Mentor
+	if changed {
+		if err := dbFor(c).Where("name = ?", body.NewMentor).First(&newment).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 	}
-
-	// fmt.Println(user)
-	// fmt.Println(ment)
-	// fmt.Println(newment)
-	// fmt.Println(body)
+	oldMentor := user.Mentor
 
 	user.Mentor = body.NewMentor
 	user.Name = body.Name
@@ -95,20 +47,45 @@ func MentorUpdate(c *gin.Context) {
 	user.Date = body.Date
 	user.Sub = body.Sub
 
-	ment.Onn = ment.Onn - 1
-	newment.Onn = newment.Onn + 1
-
-	if err := db3.Save(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if changed {
+			if err := moveOpenTickets(tx, user.ID, newment.ID); err != nil {
+				return err
+			}
+		}
+		// An expired student's slot was already freed by the renewal job, and
+		// re-enrolling takes one on whoever is their mentor by then
+		if !changed || user.Expired {
+			return nil
+		}
+		if oldMentor != "" {
+			if err := tx.Model(&MentorSchema{}).Where("name = ? AND onn > 0", oldMentor).Update("onn", gorm.Expr("onn - 1")).Error; err != nil {
+				return err
+			}
+		}
+		result := tx.Model(&newment).Where("onn < handle").Update("onn", gorm.Expr("onn + 1"))
+		if result.Error == nil && result.RowsAffected == 0 {
+			return errMentorFull
+		}
+		return result.Error
+	})
+	if errors.Is(err, errMentorFull) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "mentor can't handle this much"})
 		return
-	}
-	if err := db3.Save(&ment).Error; err != nil {
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if err := db3.Save(&newment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+
+	if changed {
+		events.Publish(events.StudentAssigned, events.Student{
+			ID: user.ID, Name: user.Name, Phone: user.Phone, Email: user.Email, Date: user.Date,
+			Class: user.Class, Sub: user.Sub, Mentor: user.Mentor, Expired: user.Expired,
+		})
+		sendText(user.Phone, notify.StudentMentorAssigned, gin.H{"Name": user.Name, "Mentor": newment.Name, "MentorPhone": newment.Phone})
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "UserData updated sucessfully"})
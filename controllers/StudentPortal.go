@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"guidance/jobs"
+	"guidance/models"
+	"guidance/notify"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	loginCodeTTL      = 10 * time.Minute
+	loginCodeCooldown = time.Minute
+	maxCodeAttempts   = 5
+	studentSessionTTL = 30 * 24 * time.Hour
+)
+
+// findStudent looks a student up by email or phone.
+func findStudent(c *gin.Context, identifier string) (UserSchema, error) {
+	var student UserSchema
+	identifier = strings.TrimSpace(identifier)
+	query := dbFor(c).Where("phone = ?", identifier)
+	if strings.Contains(identifier, "@") {
+		query = dbFor(c).Where("LOWER(email) = ?", strings.ToLower(identifier))
+	}
+	err := query.First(&student).Error
+	return student, err
+}
+
+func hashCode(studentID uint, code string) string {
+	return hashToken(fmt.Sprintf("%d:%s", studentID, code))
+}
+
+// newCode returns a random six digit code.
+func newCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// StudentLoginRequest sends a one-time login code to the student's email or
+// phone. The response is the same whether or not the student exists.
+func StudentLoginRequest(c *gin.Context) {
+	var input LoginCodeRequest
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	channel := input.Channel
+	if channel == "" {
+		channel = "sms"
+		if strings.Contains(input.Identifier, "@") {
+			channel = "email"
+		}
+	}
+	if channel != "email" && channel != "sms" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "channel must be email or sms"})
+		return
+	}
+	response := gin.H{"message": "If an account exists, a login code has been sent"}
+
+	student, err := findStudent(c, input.Identifier)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusOK, response)
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing user"})
+		}
+		return
+	}
+
+	var last models.LoginCode
+	if err := dbFor(c).Where("student_id = ?", student.ID).Order("created_at DESC").First(&last).Error; err == nil {
+		if time.Since(last.CreatedAt) < loginCodeCooldown {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+	}
+
+	code, err := newCode()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate code"})
+		return
+	}
+
+	// Only the newest code is valid
+	now := time.Now()
+	if err := dbFor(c).Model(&models.LoginCode{}).Where("student_id = ? AND used_at IS NULL", student.ID).Update("used_at", now).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	login := models.LoginCode{StudentID: student.ID, Channel: channel, CodeHash: hashCode(student.ID, code), ExpiresAt: now.Add(loginCodeTTL)}
+	if err := dbFor(c).Create(&login).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+
+	data := gin.H{"Name": student.Name, "Code": code, "Minutes": int(loginCodeTTL.Minutes())}
+	if channel == "email" {
+		sendEmail(student.Email, notify.LoginCode, data)
+	} else {
+		sendText(student.Phone, notify.StudentLoginCode, data)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// StudentLoginVerify exchanges a valid code for a bearer token.
+func StudentLoginVerify(c *gin.Context) {
+	var input LoginCodeVerify
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	invalid := gin.H{"error": "Invalid or expired code"}
+	if credentialBlocked(c, "student", input.Identifier) {
+		return
+	}
+
+	student, err := findStudent(c, input.Identifier)
+	if err != nil {
+		credentialFailed(c, "student", input.Identifier)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, invalid)
+		return
+	}
+	var login models.LoginCode
+	if err := dbFor(c).Where("student_id = ? AND used_at IS NULL AND expires_at > ?", student.ID, time.Now()).Order("created_at DESC").First(&login).Error; err != nil {
+		credentialFailed(c, "student", input.Identifier)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, invalid)
+		return
+	}
+	if login.Attempts >= maxCodeAttempts {
+		credentialFailed(c, "student", input.Identifier)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, invalid)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(login.CodeHash), []byte(hashCode(student.ID, strings.TrimSpace(input.Code)))) != 1 {
+		dbFor(c).Model(&login).Update("attempts", gorm.Expr("attempts + 1"))
+		credentialFailed(c, "student", input.Identifier)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, invalid)
+		return
+	}
+
+	credentialSucceeded(c, "student", input.Identifier)
+	now := time.Now()
+	if err := dbFor(c).Model(&login).Update("used_at", now).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	token, expiresAt, err := issueSession(c, "student", student.ID, studentSessionTTL)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": token, "expiresAt": expiresAt, "student": student})
+}
+
+// currentStudent loads the signed in student.
+func currentStudent(c *gin.Context) (UserSchema, bool) {
+	var student UserSchema
+	if err := dbFor(c).First(&student, c.GetUint("principalID")).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return student, false
+	}
+	return student, true
+}
+
+// periodStart is the start of the student's current paid period: their
+// enrollment date or the latest re-enrollment, whichever is later.
+func periodStart(c *gin.Context, student UserSchema) string {
+	start := student.Date
+	var renroll RenrollSchema
+	if err := dbFor(c).Where("phone = ?", student.Phone).Order("date DESC").First(&renroll).Error; err == nil && renroll.Date > start {
+		start = renroll.Date
+	}
+	return start
+}
+
+// Me returns the signed in student's profile with their mentor, plan and
+// renewal date.
+func Me(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+
+	var mentor gin.H
+	if student.Mentor != "" {
+		var ment MentorSchema
+		if err := dbFor(c).Where("name = ?", student.Mentor).First(&ment).Error; err == nil {
+			mentor = gin.H{"name": ment.Name, "phone": ment.Phone, "college": ment.College}
+		}
+	}
+
+	start := periodStart(c, student)
+	renewal := ""
+	if t, err := time.Parse("2006-01-02", start); err == nil {
+		renewal = t.AddDate(0, 0, jobs.PlanDays).Format("2006-01-02")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"student":     student,
+		"mentor":      mentor,
+		"plan":        gin.H{"sub": student.Sub, "class": student.Class},
+		"periodStart": start,
+		"renewalDate": renewal,
+		"expired":     student.Expired,
+	})
+}
+
+// MePayments lists the signed in student's payments, newest first.
+func MePayments(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+	var payments []models.Payment
+	if err := dbFor(c).Where("phone = ? OR LOWER(email) = ?", student.Phone, strings.ToLower(student.Email)).Order("captured_at DESC").Find(&payments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, payments)
+}
+
+// MeContactUpdate starts a change of the signed in student's email or phone.
+// A code is sent to the new address and nothing is saved until it has been
+// confirmed with MeContactVerify.
+func MeContactUpdate(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+	var input ContactUpdate
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	email := strings.TrimSpace(input.Email)
+	phone := strings.TrimSpace(input.Phone)
+	if (email == "") == (phone == "") {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Send either email or phone"})
+		return
+	}
+	if email != "" && !strings.Contains(email, "@") {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "email is invalid"})
+		return
+	}
+	if phone != "" {
+		if phone == student.Phone {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Phone number is unchanged"})
+			return
+		}
+		var other UserSchema
+		if err := dbFor(c).Where("phone = ?", phone).First(&other).Error; err == nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Phone number already exists"})
+			return
+		}
+	}
+
+	var last models.ContactChange
+	if err := dbFor(c).Where("student_id = ?", student.ID).Order("created_at DESC").First(&last).Error; err == nil {
+		if time.Since(last.CreatedAt) < loginCodeCooldown {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Please wait before requesting another code"})
+			return
+		}
+	}
+
+	code, err := newCode()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate code"})
+		return
+	}
+	// Only the newest pending change can be confirmed
+	now := time.Now()
+	if err := dbFor(c).Model(&models.ContactChange{}).Where("student_id = ? AND used_at IS NULL", student.ID).Update("used_at", now).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	change := models.ContactChange{StudentID: student.ID, Channel: "email", Value: email, CodeHash: hashCode(student.ID, code), ExpiresAt: now.Add(loginCodeTTL)}
+	if phone != "" {
+		change.Channel, change.Value = "sms", phone
+	}
+	if err := dbFor(c).Create(&change).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+
+	data := gin.H{"Name": student.Name, "Code": code, "Minutes": int(loginCodeTTL.Minutes())}
+	if change.Channel == "email" {
+		sendEmail(change.Value, notify.ContactCode, data)
+	} else {
+		sendText(change.Value, notify.StudentContactCode, data)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "A verification code has been sent to the new contact"})
+}
+
+// MeContactVerify applies a pending contact change once its code is
+// confirmed. The phone links the student's re-enrollment records, so those
+// follow along.
+func MeContactVerify(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+	var input ContactVerify
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	invalid := gin.H{"error": "Invalid or expired code"}
+
+	var change models.ContactChange
+	if err := dbFor(c).Where("student_id = ? AND used_at IS NULL AND expires_at > ?", student.ID, time.Now()).Order("created_at DESC").First(&change).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, invalid)
+		return
+	}
+	if change.Attempts >= maxCodeAttempts {
+		c.AbortWithStatusJSON(http.StatusBadRequest, invalid)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(change.CodeHash), []byte(hashCode(student.ID, strings.TrimSpace(input.Code)))) != 1 {
+		dbFor(c).Model(&change).Update("attempts", gorm.Expr("attempts + 1"))
+		c.AbortWithStatusJSON(http.StatusBadRequest, invalid)
+		return
+	}
+
+	oldPhone, oldEmail := student.Phone, student.Email
+	if change.Channel == "sms" {
+		var other UserSchema
+		if err := dbFor(c).Where("phone = ? AND id <> ?", change.Value, student.ID).First(&other).Error; err == nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Phone number already exists"})
+			return
+		}
+		student.Phone = change.Value
+	} else {
+		student.Email = change.Value
+	}
+
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&change).Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.Save(&student).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"phone": student.Phone, "email": student.Email}
+		if err := tx.Model(&RenrollSchema{}).Where("phone = ?", oldPhone).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ReenrollmentLog{}).Where("phone = ?", oldPhone).Update("phone", student.Phone).Error; err != nil {
+			return err
+		}
+		// MePayments finds payments by phone and email, so carry them over
+		// or the student loses their payment history.
+		if err := tx.Model(&models.Payment{}).Where("phone = ?", oldPhone).Update("phone", student.Phone).Error; err != nil {
+			return err
+		}
+		if oldEmail == "" {
+			return nil
+		}
+		return tx.Model(&models.Payment{}).Where("LOWER(email) = ?", strings.ToLower(oldEmail)).Update("email", student.Email).Error
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Contact details updated successfully", "student": student})
+}
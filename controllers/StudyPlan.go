@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"errors"
+	"guidance/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func buildTask(input StudyTaskInput) (models.StudyTask, error) {
+	subject, ok := subjects[strings.ToLower(strings.TrimSpace(input.Subject))]
+	if !ok {
+		return models.StudyTask{}, errors.New("subject must be physics, chemistry or maths")
+	}
+	if _, err := time.Parse("2006-01-02", input.DueDate); err != nil {
+		return models.StudyTask{}, errors.New("dueDate must be YYYY-MM-DD")
+	}
+	return models.StudyTask{
+		Subject:     subject,
+		Chapter:     strings.TrimSpace(input.Chapter),
+		Description: input.Description,
+		DueDate:     input.DueDate,
+		Status:      models.TaskPending,
+	}, nil
+}
+
+// StudyPlanPost creates the weekly plan for one of the mentor's students.
+// weekStart is normalised to the Monday of the given week and only one plan
+// per student and week is allowed.
+func StudyPlanPost(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+	id, ok := paramID(c, "id", "student")
+	if !ok {
+		return
+	}
+	student, ok := assignedStudent(c, ment, id)
+	if !ok {
+		return
+	}
+
+	var input StudyPlanInput
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	week, err := time.Parse("2006-01-02", input.WeekStart)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "weekStart must be YYYY-MM-DD"})
+		return
+	}
+	week = week.AddDate(0, 0, -((int(week.Weekday()) + 6) % 7))
+
+	plan := models.StudyPlan{MentorID: ment.ID, StudentID: student.ID, WeekStart: week.Format("2006-01-02"), Title: input.Title}
+	for _, t := range input.Tasks {
+		task, err := buildTask(t)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		plan.Tasks = append(plan.Tasks, task)
+	}
+
+	var existing models.StudyPlan
+	if err := dbFor(c).Where("student_id = ? AND week_start = ?", student.ID, plan.WeekStart).First(&existing).Error; err == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "A plan for this week already exists"})
+		return
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing plan"})
+		return
+	}
+
+	// The unique index settles two requests racing past the check above
+	exists := false
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		result := tx.Omit("Tasks").Clauses(clause.OnConflict{DoNothing: true}).Create(&plan)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			exists = true
+			return nil
+		}
+		for i := range plan.Tasks {
+			plan.Tasks[i].PlanID = plan.ID
+		}
+		if len(plan.Tasks) == 0 {
+			return nil
+		}
+		return tx.Create(&plan.Tasks).Error
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	if exists {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "A plan for this week already exists"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Study plan created successfully", "plan": plan})
+}
+
+// StudyTaskPost adds a task to an existing plan owned by the mentor.
+func StudyTaskPost(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+	var plan models.StudyPlan
+	if err := dbFor(c).Where("id = ? AND mentor_id = ?", c.Param("planId"), ment.ID).First(&plan).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+		return
+	}
+
+	var input StudyTaskInput
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	task, err := buildTask(input)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	task.PlanID = plan.ID
+	if err := dbFor(c).Create(&task).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Task added successfully", "task": task})
+}
+
+// MentorStudentPlansGet lists the plans a mentor made for one student.
+func MentorStudentPlansGet(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+	var plans []models.StudyPlan
+	if err := dbFor(c).Preload("Tasks").Where("mentor_id = ? AND student_id = ?", ment.ID, c.Param("id")).Order("week_start DESC").Find(&plans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, plans)
+}
+
+// StudentPlansGet lists a student's plans, newest week first.
+func StudentPlansGet(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+	var plans []models.StudyPlan
+	if err := dbFor(c).Preload("Tasks").Where("student_id = ?", student.ID).Order("week_start DESC").Find(&plans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, plans)
+}
+
+// StudentTaskUpdate marks one of the student's tasks complete, or pending
+// again with {"completed": false}.
+func StudentTaskUpdate(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+
+	input := TaskStatusInput{Completed: true}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var task models.StudyTask
+	err := dbFor(c).Joins("JOIN study_plans ON study_plans.id = study_tasks.plan_id").
+		Where("study_tasks.id = ? AND study_plans.student_id = ?", c.Param("taskId"), student.ID).
+		First(&task).Error
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+
+	if input.Completed {
+		now := time.Now()
+		task.Status = models.TaskCompleted
+		task.CompletedAt = &now
+	} else {
+		task.Status = models.TaskPending
+		task.CompletedAt = nil
+	}
+	if err := dbFor(c).Save(&task).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Task updated successfully", "task": task})
+}
+
+func completionRate(completed, tasks int) float64 {
+	if tasks == 0 {
+		return 0
+	}
+	return float64(completed) / float64(tasks)
+}
+
+// TaskStatsGet reports task completion per mentor next to their Handle, Onn
+// and Total counters.
+func TaskStatsGet(c *gin.Context) {
+	today := time.Now().Format("2006-01-02")
+	var stats []MentorTaskStats
+	err := dbFor(c).Raw(`SELECT m.id AS mentor_id, m.name, m.handle, m.onn, m.total,
+			COUNT(t.id) AS tasks,
+			COUNT(t.id) FILTER (WHERE t.status = ?) AS completed,
+			COUNT(t.id) FILTER (WHERE t.status <> ? AND t.due_date < ?) AS overdue
+		FROM mentor_schemas m
+		LEFT JOIN study_plans p ON p.mentor_id = m.id
+		LEFT JOIN study_tasks t ON t.plan_id = p.id
+		GROUP BY m.id
+		ORDER BY m.name`, models.TaskCompleted, models.TaskCompleted, today).Scan(&stats).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range stats {
+		stats[i].Rate = completionRate(stats[i].Completed, stats[i].Tasks)
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// MentorTaskStatsGet reports task completion for each student with a plan
+// from the mentor.
+func MentorTaskStatsGet(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+	today := time.Now().Format("2006-01-02")
+	var stats []StudentTaskStats
+	err := dbFor(c).Raw(`SELECT u.id AS student_id, u.name,
+			COUNT(t.id) AS tasks,
+			COUNT(t.id) FILTER (WHERE t.status = ?) AS completed,
+			COUNT(t.id) FILTER (WHERE t.status <> ? AND t.due_date < ?) AS overdue
+		FROM study_plans p
+		JOIN user_schemas u ON u.id = p.student_id
+		LEFT JOIN study_tasks t ON t.plan_id = p.id
+		WHERE p.mentor_id = ?
+		GROUP BY u.id
+		ORDER BY u.name`, models.TaskCompleted, models.TaskCompleted, today, ment.ID).Scan(&stats).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range stats {
+		stats[i].Rate = completionRate(stats[i].Completed, stats[i].Tasks)
+	}
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"errors"
+	"guidance/models"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var subjects = map[string]string{
+	"physics":     "physics",
+	"chemistry":   "chemistry",
+	"maths":       "maths",
+	"math":        "maths",
+	"mathematics": "maths",
+}
+
+// defaultMaxScore is the per subject maximum in JEE Main.
+const defaultMaxScore = 100
+
+// buildScores validates a submitted test and turns it into rows.
+func buildScores(studentID uint, input TestResultInput, recordedBy string) ([]models.TestScore, error) {
+	if _, err := time.Parse("2006-01-02", input.Date); err != nil {
+		return nil, errors.New("date must be YYYY-MM-DD")
+	}
+	if len(input.Scores) == 0 {
+		return nil, errors.New("at least one subject score is required")
+	}
+
+	seen := map[string]bool{}
+	rows := make([]models.TestScore, 0, len(input.Scores))
+	for _, s := range input.Scores {
+		subject, ok := subjects[strings.ToLower(strings.TrimSpace(s.Subject))]
+		if !ok {
+			return nil, errors.New("subject must be physics, chemistry or maths")
+		}
+		if seen[subject] {
+			return nil, errors.New("each subject can only be scored once per test")
+		}
+		seen[subject] = true
+
+		maxScore := s.MaxScore
+		if maxScore == 0 {
+			maxScore = defaultMaxScore
+		}
+		// negative marking means a score can drop below zero
+		if maxScore < 0 || s.Score > maxScore || s.Score < -maxScore {
+			return nil, errors.New("score is out of range for " + subject)
+		}
+		if s.Percentile < 0 || s.Percentile > 100 {
+			return nil, errors.New("percentile must be between 0 and 100")
+		}
+
+		rows = append(rows, models.TestScore{
+			StudentID:  studentID,
+			TestName:   strings.TrimSpace(input.TestName),
+			Subject:    subject,
+			Score:      s.Score,
+			MaxScore:   maxScore,
+			Percentile: s.Percentile,
+			Date:       input.Date,
+			RecordedBy: recordedBy,
+		})
+	}
+	return rows, nil
+}
+
+func saveTestResult(c *gin.Context, studentID uint, recordedBy string) {
+	var input TestResultInput
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rows, err := buildScores(studentID, input, recordedBy)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := dbFor(c).Create(&rows).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Test result saved successfully", "scores": rows})
+}
+
+// MentorTestPost lets a mentor record a mock test for one of their students.
+func MentorTestPost(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+	id, ok := paramID(c, "id", "student")
+	if !ok {
+		return
+	}
+	student, ok := assignedStudent(c, ment, id)
+	if !ok {
+		return
+	}
+	saveTestResult(c, student.ID, "mentor")
+}
+
+// StudentTestPost lets a student record their own mock test.
+func StudentTestPost(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+	saveTestResult(c, student.ID, "student")
+}
+
+func percent(s models.TestScore) float64 {
+	if s.MaxScore == 0 {
+		return 0
+	}
+	return s.Score / s.MaxScore * 100
+}
+
+// subjectTrends groups one student's scores by subject in date order.
+func subjectTrends(scores []models.TestScore) []SubjectTrend {
+	bySubject := map[string]*SubjectTrend{}
+	for _, s := range scores {
+		t, ok := bySubject[s.Subject]
+		if !ok {
+			t = &SubjectTrend{Subject: s.Subject}
+			bySubject[s.Subject] = t
+		}
+		t.Points = append(t.Points, TrendPoint{
+			TestName:   s.TestName,
+			Date:       s.Date,
+			Score:      s.Score,
+			MaxScore:   s.MaxScore,
+			Percent:    percent(s),
+			Percentile: s.Percentile,
+		})
+	}
+
+	trends := make([]SubjectTrend, 0, len(bySubject))
+	for _, t := range bySubject {
+		first, last := t.Points[0], t.Points[len(t.Points)-1]
+		t.Change = last.Percent - first.Percent
+		trends = append(trends, *t)
+	}
+	sort.Slice(trends, func(i, j int) bool { return trends[i].Subject < trends[j].Subject })
+	return trends
+}
+
+// StudentTestTrend returns a student's scores per subject over time with
+// the change between their first and latest test.
+func StudentTestTrend(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+	var scores []models.TestScore
+	if err := dbFor(c).Where("student_id = ?", student.ID).Order("date, id").Find(&scores).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"student": student, "subjects": subjectTrends(scores)})
+}
+
+// MentorTestSummary aggregates the trends of a mentor's current students so
+// it is visible whether they are improving.
+func MentorTestSummary(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+	var students []UserSchema
+	if err := dbFor(c).Where("mentor = ? AND expired = ?", ment.Name, false).Find(&students).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ids := make([]uint, 0, len(students))
+	for _, s := range students {
+		ids = append(ids, s.ID)
+	}
+
+	var scores []models.TestScore
+	if len(ids) > 0 {
+		if err := dbFor(c).Where("student_id IN ?", ids).Order("date, id").Find(&scores).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	byStudent := map[uint][]models.TestScore{}
+	for _, s := range scores {
+		byStudent[s.StudentID] = append(byStudent[s.StudentID], s)
+	}
+
+	aggregates := map[string]*SubjectAggregate{}
+	perStudent := make([]gin.H, 0, len(students))
+	for _, student := range students {
+		trends := subjectTrends(byStudent[student.ID])
+		perStudent = append(perStudent, gin.H{"id": student.ID, "name": student.Name, "subjects": trends})
+		for _, t := range trends {
+			a, ok := aggregates[t.Subject]
+			if !ok {
+				a = &SubjectAggregate{Subject: t.Subject}
+				aggregates[t.Subject] = a
+			}
+			a.Students++
+			a.AverageLatest += t.Points[len(t.Points)-1].Percent
+			a.AverageChange += t.Change
+			if t.Change > 0 {
+				a.Improving++
+			} else if t.Change < 0 {
+				a.Declining++
+			}
+		}
+	}
+
+	summary := make([]SubjectAggregate, 0, len(aggregates))
+	for _, a := range aggregates {
+		a.AverageLatest /= float64(a.Students)
+		a.AverageChange /= float64(a.Students)
+		summary = append(summary, *a)
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Subject < summary[j].Subject })
+
+	c.JSON(http.StatusOK, gin.H{"mentor": ment.Name, "subjects": summary, "students": perStudent})
+}
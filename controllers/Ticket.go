@@ -0,0 +1,430 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"guidance/blob"
+	"guidance/models"
+	"guidance/notify"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxAttachments    = 5
+	maxAttachmentSize = 10 << 20
+)
+
+// ticketSLA and blobs are set from the config by Setup.
+var ticketSLA = 24 * time.Hour
+var blobs blob.Store
+
+// attachmentFiles returns the files uploaded under "attachments" when the
+// request is multipart, enforcing the count and size limits.
+func attachmentFiles(c *gin.Context) ([]*multipart.FileHeader, error) {
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		return nil, nil
+	}
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	files := form.File["attachments"]
+	if len(files) > maxAttachments {
+		return nil, fmt.Errorf("at most %d attachments are allowed", maxAttachments)
+	}
+	for _, f := range files {
+		if f.Size > maxAttachmentSize {
+			return nil, fmt.Errorf("%s is larger than %d MB", f.Filename, maxAttachmentSize>>20)
+		}
+	}
+	return files, nil
+}
+
+// storeAttachments writes the files to the blob store and records them with
+// tx. It returns the keys of the blobs written so far, which the caller
+// removes again when the transaction does not commit.
+func storeAttachments(tx *gorm.DB, ticketID, replyID uint, files []*multipart.FileHeader) ([]string, error) {
+	var keys []string
+	for _, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			return keys, err
+		}
+		// The type is taken from the content, the client's header is not trusted
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(f, head)
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return keys, err
+		}
+		name := filepath.Base(fh.Filename)
+		key := fmt.Sprintf("tickets/%d/%d-%s", ticketID, time.Now().UnixNano(), name)
+		size, err := blobs.Put(key, f)
+		f.Close()
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+		attachment := models.TicketAttachment{
+			TicketID:    ticketID,
+			ReplyID:     replyID,
+			FileName:    name,
+			ContentType: http.DetectContentType(head[:n]),
+			Size:        size,
+			BlobKey:     key,
+		}
+		if err := tx.Create(&attachment).Error; err != nil {
+			return keys, err
+		}
+	}
+	return keys, nil
+}
+
+func removeBlobs(keys []string) {
+	for _, key := range keys {
+		blobs.Delete(key)
+	}
+}
+
+// moveOpenTickets hands a student's unresolved tickets to their new mentor,
+// who then answers them and gets the access the old mentor loses.
+func moveOpenTickets(tx *gorm.DB, studentID, mentorID uint) error {
+	return tx.Model(&models.Ticket{}).
+		Where("student_id = ? AND status <> ?", studentID, models.TicketClosed).
+		Update("mentor_id", mentorID).Error
+}
+
+// TicketPost opens a ticket and routes it to the student's mentor.
+func TicketPost(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+	var input TicketInput
+	if err := c.ShouldBind(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	files, err := attachmentFiles(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if student.Mentor == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "No mentor has been assigned yet"})
+		return
+	}
+	var ment MentorSchema
+	if err := dbFor(c).Where("name = ?", student.Mentor).First(&ment).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to find assigned mentor"})
+		return
+	}
+
+	ticket := models.Ticket{
+		StudentID: student.ID,
+		MentorID:  ment.ID,
+		Subject:   input.Subject,
+		Title:     input.Title,
+		Status:    models.TicketOpen,
+		DueAt:     time.Now().Add(ticketSLA),
+	}
+	var stored []string
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&ticket).Error; err != nil {
+			return err
+		}
+		reply := models.TicketReply{TicketID: ticket.ID, Author: "student", Body: input.Body}
+		if err := tx.Create(&reply).Error; err != nil {
+			return err
+		}
+		var err error
+		stored, err = storeAttachments(tx, ticket.ID, reply.ID, files)
+		return err
+	})
+	if err != nil {
+		removeBlobs(stored)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+
+	var cred MentorLogin
+	if err := dbFor(c).Where("mentor_name = ?", ment.Name).First(&cred).Error; err == nil {
+		sendEmail(cred.Email, notify.TicketOpened, gin.H{
+			"Mentor":  ment.Name,
+			"Student": student.Name,
+			"Subject": ticket.Subject,
+			"Title":   ticket.Title,
+			"Body":    input.Body,
+			"DueAt":   ticket.DueAt.Format("02 Jan 15:04"),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ticket raised successfully", "ticket": ticket})
+}
+
+func ticketQuery(c *gin.Context, status string) *gorm.DB {
+	query := dbFor(c).Order("updated_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	return query
+}
+
+func StudentTicketsGet(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+	var tickets []models.Ticket
+	if err := ticketQuery(c, c.Query("status")).Where("student_id = ?", student.ID).Find(&tickets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tickets)
+}
+
+func MentorTicketsGet(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+	var tickets []models.Ticket
+	if err := ticketQuery(c, c.Query("status")).Where("mentor_id = ?", ment.ID).Find(&tickets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tickets)
+}
+
+// OwnerTicketsGet lists all tickets, ?escalated=true narrows it to the ones
+// that missed their SLA.
+func OwnerTicketsGet(c *gin.Context) {
+	query := ticketQuery(c, c.Query("status"))
+	if c.Query("escalated") == "true" {
+		query = query.Where("escalated = ?", true)
+	}
+	var tickets []models.Ticket
+	if err := query.Find(&tickets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tickets)
+}
+
+// loadTicket fetches the :id ticket with its thread, limited to the column
+// owner when ownerColumn is set.
+func loadTicket(c *gin.Context, ownerColumn string, ownerID uint) (models.Ticket, bool) {
+	var ticket models.Ticket
+	id, ok := paramID(c, "id", "ticket")
+	if !ok {
+		return ticket, false
+	}
+	query := dbFor(c).Preload("Replies", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).Preload("Attachments")
+	if ownerColumn != "" {
+		query = query.Where(ownerColumn+" = ?", ownerID)
+	}
+	if err := query.First(&ticket, id).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return ticket, false
+	}
+	return ticket, true
+}
+
+func StudentTicketGet(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+	if ticket, ok := loadTicket(c, "student_id", student.ID); ok {
+		c.JSON(http.StatusOK, ticket)
+	}
+}
+
+func MentorTicketGet(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+	if ticket, ok := loadTicket(c, "mentor_id", ment.ID); ok {
+		c.JSON(http.StatusOK, ticket)
+	}
+}
+
+func OwnerTicketGet(c *gin.Context) {
+	if ticket, ok := loadTicket(c, "", 0); ok {
+		c.JSON(http.StatusOK, ticket)
+	}
+}
+
+// addReply appends a reply to the thread and moves the ticket along: a
+// student reply reopens it and starts a new SLA window if it had been
+// answered, a mentor or owner reply marks it answered.
+func addReply(c *gin.Context, ticket models.Ticket, author string) {
+	if ticket.Status == models.TicketClosed {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Ticket is closed"})
+		return
+	}
+	var input TicketReplyInput
+	if err := c.ShouldBind(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	files, err := attachmentFiles(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	if author == "student" {
+		if ticket.Status == models.TicketAnswered {
+			// A reopened ticket starts a fresh SLA window, which can escalate again
+			updates["status"] = models.TicketOpen
+			updates["due_at"] = time.Now().Add(ticketSLA)
+			updates["escalated"] = false
+			updates["escalated_at"] = nil
+		}
+	} else {
+		updates["status"] = models.TicketAnswered
+	}
+	reply := models.TicketReply{TicketID: ticket.ID, Author: author, Body: input.Body}
+	var stored []string
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&reply).Error; err != nil {
+			return err
+		}
+		var err error
+		if stored, err = storeAttachments(tx, ticket.ID, reply.ID, files); err != nil {
+			return err
+		}
+		return tx.Model(&models.Ticket{}).Where("id = ?", ticket.ID).Updates(updates).Error
+	})
+	if err != nil {
+		removeBlobs(stored)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reply added successfully", "reply": reply})
+}
+
+func StudentTicketReply(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+	if ticket, ok := loadTicket(c, "student_id", student.ID); ok {
+		addReply(c, ticket, "student")
+	}
+}
+
+func MentorTicketReply(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+	if ticket, ok := loadTicket(c, "mentor_id", ment.ID); ok {
+		addReply(c, ticket, "mentor")
+	}
+}
+
+func OwnerTicketReply(c *gin.Context) {
+	if ticket, ok := loadTicket(c, "", 0); ok {
+		addReply(c, ticket, "owner")
+	}
+}
+
+func closeTicket(c *gin.Context, ticket models.Ticket) {
+	if err := dbFor(c).Model(&models.Ticket{}).Where("id = ?", ticket.ID).Update("status", models.TicketClosed).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Ticket closed successfully"})
+}
+
+func StudentTicketClose(c *gin.Context) {
+	student, ok := currentStudent(c)
+	if !ok {
+		return
+	}
+	if ticket, ok := loadTicket(c, "student_id", student.ID); ok {
+		closeTicket(c, ticket)
+	}
+}
+
+func MentorTicketClose(c *gin.Context) {
+	ment, ok := currentMentor(c)
+	if !ok {
+		return
+	}
+	if ticket, ok := loadTicket(c, "mentor_id", ment.ID); ok {
+		closeTicket(c, ticket)
+	}
+}
+
+// TicketAttachmentGet streams an attachment out of the blob store. Students
+// and mentors can only fetch attachments of their own tickets.
+func TicketAttachmentGet(c *gin.Context) {
+	id, ok := paramID(c, "id", "attachment")
+	if !ok {
+		return
+	}
+	query := dbFor(c).Model(&models.TicketAttachment{}).
+		Joins("JOIN tickets ON tickets.id = ticket_attachments.ticket_id").
+		Where("ticket_attachments.id = ?", id)
+	switch c.GetString("sessionKind") {
+	case "student":
+		student, ok := currentStudent(c)
+		if !ok {
+			return
+		}
+		query = query.Where("tickets.student_id = ?", student.ID)
+	case "mentor":
+		ment, ok := currentMentor(c)
+		if !ok {
+			return
+		}
+		query = query.Where("tickets.mentor_id = ?", ment.ID)
+	case "owner":
+	default:
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Not allowed"})
+		return
+	}
+
+	var attachment models.TicketAttachment
+	if err := query.Select("ticket_attachments.*").First(&attachment).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	r, err := blobs.Get(attachment.BlobKey)
+	if err != nil {
+		if errors.Is(err, blob.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	defer r.Close()
+
+	// Sniff again rather than trust the stored type, older rows hold
+	// whatever the client sent
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", attachment.FileName))
+	c.DataFromReader(http.StatusOK, attachment.Size, http.DetectContentType(head[:n]), io.MultiReader(bytes.NewReader(head[:n]), r), nil)
+}
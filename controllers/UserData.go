@@ -2,81 +2,31 @@ package controllers
 
 import (
 	"errors"
-	"fmt"
+	"guidance/events"
 	"guidance/models"
-	"log"
 	"net/http"
-	"os"
 	"sync"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Error loading .env file")
-	}
-
-	host := os.Getenv("DB_HOST")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbname := os.Getenv("DB_NAME")
-	port := os.Getenv("DB_PORT")
-
-	dsn := "host=" + host + " user=" + user + " password=" + password + " dbname=" + dbname + " port=" + port
-
-	// Implement retry logic
-	var database *gorm.DB
-	var err error
-	maxRetries := 5
-	for i := 0; i < maxRetries; i++ {
-		database, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-		if err == nil {
-			break
-		}
-		log.Printf("Failed to connect to database (attempt %d/%d): %v", i+1, maxRetries, err)
-		time.Sleep(2 * time.Second) // Wait before retrying
-	}
-	if err != nil {
-		log.Fatalf("Failed to connect to database after %d attempts: %v", maxRetries, err)
-	}
-
-	db1 = database
-
-	// Set the maximum number of open connections in the connection pool
-	sqlDB, err := db1.DB()
-	if err != nil {
-		log.Fatalf("Failed to get database connection: %v", err)
-	}
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetConnMaxLifetime(time.Hour)
-
-	log.Println("Successfully connected to the database")
-}
-
 func UserGet(c *gin.Context) {
 	var wg sync.WaitGroup
 
 	// Query the database to get all users
-	rows, err := db1.Model(&UserSchema{}).Rows()
+	rows, err := dbFor(c).Model(&UserSchema{}).Rows()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	defer rows.Close()
 
-	fmt.Println(rows)
-
 	// Collect all rows in a slice
 	var userSchemas []UserSchema
 	for rows.Next() {
 		var user UserSchema
-		if err := db1.ScanRows(rows, &user); err != nil {
+		if err := dbFor(c).ScanRows(rows, &user); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -108,7 +58,6 @@ func UserGet(c *gin.Context) {
 		users = append(users, user)
 	}
 
-	fmt.Println(users)
 	c.JSON(http.StatusOK, users)
 }
 
@@ -128,7 +77,7 @@ func UserPost(c *gin.Context) {
 	go func(input User) {
 		defer wg.Done()
 		naam := UserSchema{}
-		if err := db1.Where("phone = ?", input.Phone).First(&naam).Error; err != nil {
+		if err := dbFor(c).Where("phone = ?", input.Phone).First(&naam).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				// No user found, it's safe to proceed with creating a new user
 				resultChan <- 1
@@ -157,31 +106,31 @@ func UserPost(c *gin.Context) {
 	}
 	// If user doesn't exist, proceed with saving the user
 	data := models.UserSchema{Name: input.Name, Phone: input.Phone, Email: input.Email, Date: input.Date, Class: input.Class, Sub: input.Sub, Mentor: input.Mentor}
-	if err := db1.Create(&data).Error; err != nil {
+	if err := dbFor(c).Create(&data).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
 		return
 	}
 
 	reuser := models.RenrollSchema{Name: input.Name, Phone: input.Phone, Email: input.Email, Date: input.Date, Class: input.Class, Sub: input.Sub, Mentor: "", Renrollment: 0}
-	if err := db1.Create(&reuser).Error; err != nil {
+	if err := dbFor(c).Create(&reuser).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
 		return
 	}
 
+	events.Publish(events.StudentCreated, events.Student{
+		ID: data.ID, Name: data.Name, Phone: data.Phone, Email: data.Email, Date: data.Date,
+		Class: data.Class, Sub: data.Sub, Mentor: data.Mentor, Expired: data.Expired,
+	})
+
 	c.JSON(http.StatusOK, gin.H{"message": "User data saved successfully"})
 }
 
 func DELETE(c *gin.Context) {
 	var input deleteSchema
 	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
-		fmt.Println("2")
-		fmt.Println(input)
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	fmt.Println("1")
-	fmt.Println(input.IDs)
-	fmt.Println(input.Mentors)
 
 	// today := time.Now()
 
@@ -248,20 +197,18 @@ func UserWithoutMentor(c *gin.Context) {
 	var wg sync.WaitGroup
 
 	// Query the database to get all users
-	rows, err := db1.Model(&UserSchema{}).Rows()
+	rows, err := dbFor(c).Model(&UserSchema{}).Rows()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	defer rows.Close()
 
-	fmt.Println(rows)
-
 	// Collect all rows in a slice
 	var userSchemas []UserSchema
 	for rows.Next() {
 		var user UserSchema
-		if err := db1.ScanRows(rows, &user); err != nil {
+		if err := dbFor(c).ScanRows(rows, &user); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -296,6 +243,5 @@ func UserWithoutMentor(c *gin.Context) {
 		users = append(users, user)
 	}
 
-	fmt.Println(users)
 	c.JSON(http.StatusOK, users)
 }
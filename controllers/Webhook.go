@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"guidance/events"
+	"guidance/models"
+	"guidance/webhooks"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var webhookEvents = map[string]bool{
+	"*":                      true,
+	events.StudentCreated:    true,
+	events.StudentAssigned:   true,
+	events.StudentReenrolled: true,
+	events.MentorCreated:     true,
+	events.PaymentCaptured:   true,
+}
+
+func WebhookGet(c *gin.Context) {
+	var subs []models.WebhookSubscription
+	if err := dbFor(c).Order("id").Find(&subs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, subs)
+}
+
+func WebhookPost(c *gin.Context) {
+	var input WebhookInput
+	if err := c.ShouldBindBodyWithJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := webhooks.CheckTarget(c.Request.Context(), input.URL); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(input.Events) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "at least one event is required"})
+		return
+	}
+	for _, e := range input.Events {
+		if !webhookEvents[e] {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unknown event " + e})
+			return
+		}
+	}
+
+	secret := input.Secret
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			return
+		}
+		secret = hex.EncodeToString(b)
+	}
+
+	sub := models.WebhookSubscription{URL: input.URL, Secret: secret, Events: strings.Join(input.Events, ","), Active: true}
+	if err := dbFor(c).Create(&sub).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
+		return
+	}
+
+	// The secret is only ever returned here, the subscriber needs it to verify signatures
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook created successfully", "webhook": sub, "secret": secret})
+}
+
+func WebhookDelete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid webhook id"})
+		return
+	}
+	result := dbFor(c).Delete(&models.WebhookSubscription{}, id)
+	if result.Error != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// WebhookDeliveries returns the most recent deliveries of a subscription,
+// optionally filtered by ?status=pending|delivered|failed.
+func WebhookDeliveries(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid webhook id"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	query := dbFor(c).Where("subscription_id = ?", id)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
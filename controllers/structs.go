@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -13,7 +15,7 @@ var db5 *gorm.DB //for OwnerData
 type MentorLogin struct {
 	ID         uint   `json:"id"`
 	Email      string `json:"email"`
-	Password   string `json:"password"`
+	Password   string `json:"-"`
 	MentorName string `json:"name"`
 }
 
@@ -33,14 +35,16 @@ type FinalMentorSchema struct {
 }
 
 type MentorSchema struct {
-	ID      uint   `json:"id"`
-	Name    string `json:"name"`
-	College string `json:"college"`
-	Phone   string `json:"phone"`
-	Date    string `json:"date"`
-	Handle  int    `json:"handle"`
-	Onn     int    `json:"on"`
-	Total   int    `json:"total"`
+	ID      uint    `json:"id"`
+	Name    string  `json:"name"`
+	College string  `json:"college"`
+	Phone   string  `json:"phone"`
+	Date    string  `json:"date"`
+	Handle  int     `json:"handle"`
+	Onn     int     `json:"on"`
+	Total   int     `json:"total"`
+	Rating  float64 `json:"rating" gorm:"-"`
+	Ratings int     `json:"ratings" gorm:"-"`
 }
 
 type UpdateCount struct {
@@ -72,14 +76,15 @@ type User struct {
 }
 
 type UserSchema struct {
-	ID     uint   `json:"id"`
-	Name   string `json:"name"`
-	Phone  string `json:"phone"`
-	Email  string `json:"email"`
-	Date   string `json:"date"`
-	Class  string `json:"class"`
-	Sub    string `json:"sub"`
-	Mentor string `json:"mentor"`
+	ID      uint   `json:"id"`
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Email   string `json:"email"`
+	Date    string `json:"date"`
+	Class   string `json:"class"`
+	Sub     string `json:"sub"`
+	Mentor  string `json:"mentor"`
+	Expired bool   `json:"expired"`
 }
 
 type deleteSchema struct {
@@ -179,8 +184,269 @@ type Owner struct {
 }
 
 type OwnerSchema struct {
-	ID        uint   `json:"id"`
-	Email     string `json:"email"`
-	Password  string `json:"password"`
-	OwnerName string `json:"ownername"`
+	ID           uint   `json:"id"`
+	Email        string `json:"email"`
+	Password     string `json:"-"`
+	OwnerName    string `json:"ownername"`
+	TotpSecret   string `json:"-"`
+	TotpEnabled  bool   `json:"totpEnabled"`
+	TotpLastStep int64  `json:"-"`
+}
+
+// Webhook.go
+type WebhookInput struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events" binding:"required"`
+	Secret string   `json:"secret"`
+}
+
+// Session.go
+type SessionInput struct {
+	StudentID   uint   `json:"studentId" binding:"required"`
+	ScheduledAt string `json:"scheduledAt" binding:"required"`
+	Duration    int    `json:"duration" binding:"required"`
+	Mode        string `json:"mode" binding:"required"`
+}
+
+type SessionReschedule struct {
+	ScheduledAt string `json:"scheduledAt" binding:"required"`
+	Duration    int    `json:"duration"`
+}
+
+// SessionLog.go
+type SessionLogInput struct {
+	SessionID  *uint  `json:"sessionId"`
+	StudentID  uint   `json:"studentId" binding:"required"`
+	Attendance string `json:"attendance" binding:"required"`
+	Duration   int    `json:"duration"`
+	Topics     string `json:"topics"`
+	Notes      string `json:"notes"`
+	HeldAt     string `json:"heldAt"`
+}
+
+type MentorAttendance struct {
+	MentorID       uint    `json:"mentorId"`
+	Name           string  `json:"name"`
+	Handle         int     `json:"handle"`
+	Onn            int     `json:"on"`
+	Logged         int     `json:"logged"`
+	Attended       int     `json:"attended"`
+	NoShows        int     `json:"noShows"`
+	Minutes        int     `json:"minutes"`
+	Students       int     `json:"students"`
+	AttendanceRate float64 `json:"attendanceRate"`
+}
+
+// TestScore.go
+type SubjectScore struct {
+	Subject    string  `json:"subject" binding:"required"`
+	Score      float64 `json:"score"`
+	MaxScore   float64 `json:"maxScore"`
+	Percentile float64 `json:"percentile"`
+}
+
+type TestResultInput struct {
+	TestName string         `json:"testName" binding:"required"`
+	Date     string         `json:"date" binding:"required"`
+	Scores   []SubjectScore `json:"scores" binding:"required"`
+}
+
+type TrendPoint struct {
+	TestName   string  `json:"testName"`
+	Date       string  `json:"date"`
+	Score      float64 `json:"score"`
+	MaxScore   float64 `json:"maxScore"`
+	Percent    float64 `json:"percent"`
+	Percentile float64 `json:"percentile"`
+}
+
+type SubjectTrend struct {
+	Subject string       `json:"subject"`
+	Points  []TrendPoint `json:"points"`
+	Change  float64      `json:"change"`
+}
+
+type SubjectAggregate struct {
+	Subject       string  `json:"subject"`
+	Students      int     `json:"students"`
+	AverageLatest float64 `json:"averageLatest"`
+	AverageChange float64 `json:"averageChange"`
+	Improving     int     `json:"improving"`
+	Declining     int     `json:"declining"`
+}
+
+// StudyPlan.go
+type StudyTaskInput struct {
+	Subject     string `json:"subject" binding:"required"`
+	Chapter     string `json:"chapter" binding:"required"`
+	Description string `json:"description"`
+	DueDate     string `json:"dueDate" binding:"required"`
+}
+
+type StudyPlanInput struct {
+	WeekStart string           `json:"weekStart" binding:"required"`
+	Title     string           `json:"title"`
+	Tasks     []StudyTaskInput `json:"tasks"`
+}
+
+type TaskStatusInput struct {
+	Completed bool `json:"completed"`
+}
+
+type MentorTaskStats struct {
+	MentorID  uint    `json:"mentorId"`
+	Name      string  `json:"name"`
+	Handle    int     `json:"handle"`
+	Onn       int     `json:"on"`
+	Total     int     `json:"total"`
+	Tasks     int     `json:"tasks"`
+	Completed int     `json:"completed"`
+	Overdue   int     `json:"overdue"`
+	Rate      float64 `json:"completionRate"`
+}
+
+type StudentTaskStats struct {
+	StudentID uint    `json:"studentId"`
+	Name      string  `json:"name"`
+	Tasks     int     `json:"tasks"`
+	Completed int     `json:"completed"`
+	Overdue   int     `json:"overdue"`
+	Rate      float64 `json:"completionRate"`
+}
+
+// Ticket.go
+type TicketInput struct {
+	Title   string `json:"title" form:"title" binding:"required"`
+	Subject string `json:"subject" form:"subject"`
+	Body    string `json:"body" form:"body" binding:"required"`
+}
+
+type TicketReplyInput struct {
+	Body string `json:"body" form:"body" binding:"required"`
+}
+
+// Reports.go
+type EnrollmentReportRow struct {
+	Period        string `json:"period"`
+	Class         string `json:"class"`
+	Sub           string `json:"sub"`
+	Enrollments   int    `json:"enrollments"`
+	Reenrollments int    `json:"reenrollments"`
+}
+
+type RevenueReportRow struct {
+	Period   string  `json:"period"`
+	Plan     string  `json:"plan"`
+	Payments int     `json:"payments"`
+	Amount   float64 `json:"amount"`
+}
+
+type RenewalSummary struct {
+	From        string  `json:"from"`
+	To          string  `json:"to"`
+	Due         int     `json:"due"`
+	Renewed     int     `json:"renewed"`
+	Churned     int     `json:"churned"`
+	Pending     int     `json:"pending"`
+	RenewalRate float64 `json:"renewalRate"`
+	ChurnRate   float64 `json:"churnRate"`
+}
+
+type MentorPerformanceRow struct {
+	MentorID      uint    `json:"mentorId"`
+	Name          string  `json:"name"`
+	College       string  `json:"college"`
+	Handle        int     `json:"handle"`
+	Onn           int     `json:"on"`
+	Total         int     `json:"total"`
+	Spare         int     `json:"spare"`
+	LoadPercent   float64 `json:"loadPercent"`
+	Students      int     `json:"students"`
+	Reenrolled    int     `json:"reenrolled"`
+	Lost          int     `json:"lost"`
+	RetentionRate float64 `json:"retentionRate"`
+	AverageTenure float64 `json:"averageTenureDays"`
+}
+
+// Rating.go
+type RatingInput struct {
+	Rating    int    `json:"rating" binding:"required"`
+	Comment   string `json:"comment"`
+	SessionID *uint  `json:"sessionId"`
+}
+
+type RatingTrendPoint struct {
+	Month   string  `json:"month"`
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
+// StudentPortal.go
+type LoginCodeRequest struct {
+	Identifier string `json:"identifier" binding:"required"`
+	Channel    string `json:"channel"`
+}
+
+type LoginCodeVerify struct {
+	Identifier string `json:"identifier" binding:"required"`
+	Code       string `json:"code" binding:"required"`
+}
+
+type ContactUpdate struct {
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+}
+
+type ContactVerify struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// PasswordReset.go
+type PasswordResetRequest struct {
+	Account string `json:"account" binding:"required,oneof=mentor owner"`
+	Email   string `json:"email" binding:"required"`
+}
+
+type PasswordResetConfirm struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required,min=8"`
+}
+
+// Lockout.go
+type UnlockInput struct {
+	Account    string `json:"account" binding:"required,oneof=mentor owner student ip"`
+	Identifier string `json:"identifier" binding:"required"`
+}
+
+type LockedAccount struct {
+	Key          string    `json:"key"`
+	Failures     int       `json:"failures"`
+	LastFailedAt time.Time `json:"lastFailedAt"`
+	LockedUntil  time.Time `json:"lockedUntil"`
+}
+
+// MentorAuth.go
+type MentorLoginInput struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// OwnerAuth.go
+type OwnerLoginInput struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type OwnerMFAInput struct {
+	MFAToken string `json:"mfaToken" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type TOTPCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TOTPDisableInput struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
 }
@@ -0,0 +1,70 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Event types emitted by the handlers.
+const (
+	StudentCreated    = "student.created"
+	StudentAssigned   = "student.assigned"
+	StudentReenrolled = "student.reenrolled"
+	MentorCreated     = "mentor.created"
+	PaymentCaptured   = "payment.captured"
+)
+
+// Event is a single domain event.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// Handler receives published events. Handlers run on the publisher's
+// goroutine, so anything slow must be handed off.
+type Handler func(Event)
+
+// Bus fans events out to every subscribed handler.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, h)
+}
+
+func (b *Bus) Publish(eventType string, data interface{}) Event {
+	e := Event{ID: newID(), Type: eventType, CreatedAt: time.Now().UTC(), Data: data}
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		h(e)
+	}
+	return e
+}
+
+var defaultBus = &Bus{}
+
+// Subscribe registers h on the process wide bus.
+func Subscribe(h Handler) {
+	defaultBus.Subscribe(h)
+}
+
+// Publish emits an event on the process wide bus.
+func Publish(eventType string, data interface{}) Event {
+	return defaultBus.Publish(eventType, data)
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,15 @@
+package events
+
+// Student is the payload of StudentCreated and StudentAssigned. Both events
+// carry the same fields so subscribers can decode them with one type.
+type Student struct {
+	ID      uint   `json:"id"`
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Email   string `json:"email"`
+	Date    string `json:"date"`
+	Class   string `json:"class"`
+	Sub     string `json:"sub"`
+	Mentor  string `json:"mentor"`
+	Expired bool   `json:"expired"`
+}
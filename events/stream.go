@@ -0,0 +1,100 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Entry is an event with its position in a Stream. ID is "<epoch>-<seq>",
+// where the epoch is random per Stream, so ids handed out before a restart or
+// by another replica are recognised as stale.
+type Entry struct {
+	ID    string
+	Event Event
+}
+
+// Stream keeps the most recent events in a ring buffer and fans new ones out
+// to live subscribers, letting clients resume from the last id they saw. It
+// only sees events published in this process.
+type Stream struct {
+	mu    sync.Mutex
+	epoch string
+	seq   uint64
+	buf   []Entry
+	size  int
+	subs  map[chan Entry]struct{}
+}
+
+func NewStream(size int) *Stream {
+	return &Stream{
+		epoch: newEpoch(),
+		size:  size,
+		subs:  map[chan Entry]struct{}{},
+	}
+}
+
+// Publish appends e to the buffer and delivers it to subscribers. A
+// subscriber whose channel is full is dropped; it can reconnect and replay
+// what it missed.
+func (s *Stream) Publish(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	entry := Entry{ID: fmt.Sprintf("%s-%d", s.epoch, s.seq), Event: e}
+	if len(s.buf) == s.size {
+		s.buf = s.buf[1:]
+	}
+	s.buf = append(s.buf, entry)
+	for ch := range s.subs {
+		select {
+		case ch <- entry:
+		default:
+			delete(s.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe registers a live subscriber and returns the buffered entries
+// after lastID. complete is false when lastID is unknown or has been
+// evicted, in which case the client should reload its full state.
+func (s *Stream) Subscribe(lastID string) (backlog []Entry, ch chan Entry, complete bool, cancel func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	complete = true
+	if lastID != "" {
+		complete = false
+		if epoch, seq, ok := strings.Cut(lastID, "-"); ok && epoch == s.epoch {
+			if n, err := strconv.ParseUint(seq, 10, 64); err == nil {
+				oldest := s.seq - uint64(len(s.buf)) + 1
+				if n+1 >= oldest && n <= s.seq {
+					complete = true
+					backlog = append(backlog, s.buf[len(s.buf)-int(s.seq-n):]...)
+				}
+			}
+		}
+	}
+
+	ch = make(chan Entry, 64)
+	s.subs[ch] = struct{}{}
+	cancel = func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subs[ch]; ok {
+			delete(s.subs, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, complete, cancel
+}
+
+func newEpoch() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"context"
+	"guidance/config"
+	"guidance/models"
+	"guidance/notify"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PlanDays is the length of one paid guidance period.
+const PlanDays = 30
+
+// RenewalJob reminds students whose plan is about to run out and expires the
+// ones whose plan has lapsed, releasing their slot on the mentor.
+type RenewalJob struct {
+	db           *gorm.DB
+	notifier     *notify.Service
+	remindBefore int
+	paymentLink  string
+}
+
+func NewRenewalJob(db *gorm.DB, notifier *notify.Service, cfg config.Jobs) *RenewalJob {
+	return &RenewalJob{
+		db:           db,
+		notifier:     notifier,
+		remindBefore: cfg.RenewalReminderDays,
+		paymentLink:  cfg.RenewalPaymentLink,
+	}
+}
+
+func (j *RenewalJob) Run(ctx context.Context) error {
+	db := j.db.WithContext(ctx)
+	var users []models.UserSchema
+	if err := db.Where("expired = ?", false).Find(&users).Error; err != nil {
+		return err
+	}
+
+	// A re-enrollment moves the start of the current period forward, so the
+	// later of the two dates wins.
+	var renrolls []models.RenrollSchema
+	if err := db.Find(&renrolls).Error; err != nil {
+		return err
+	}
+	renrolled := make(map[string]string, len(renrolls))
+	for _, r := range renrolls {
+		if r.Date > renrolled[r.Phone] {
+			renrolled[r.Phone] = r.Date
+		}
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	reminded, expired := 0, 0
+	for _, user := range users {
+		startDate := user.Date
+		if d := renrolled[user.Phone]; d > startDate {
+			startDate = d
+		}
+		start, err := time.Parse("2006-01-02", startDate)
+		if err != nil {
+			continue
+		}
+		due := start.AddDate(0, 0, PlanDays)
+		dueDate := due.Format("2006-01-02")
+
+		if today.After(due) {
+			if err := j.expire(db, user); err != nil {
+				slog.Error("jobs: failed to expire student", "student_id", user.ID, "error", err)
+				continue
+			}
+			expired++
+			continue
+		}
+
+		if due.Sub(today) <= time.Duration(j.remindBefore)*24*time.Hour && user.ReminderSentFor != dueDate {
+			j.remind(user, startDate, dueDate)
+			if err := db.Model(&user).Update("reminder_sent_for", dueDate).Error; err != nil {
+				slog.Error("jobs: failed to record reminder", "student_id", user.ID, "error", err)
+				continue
+			}
+			reminded++
+		}
+	}
+
+	slog.Info("jobs: renewal run finished", "reminded", reminded, "expired", expired)
+	return nil
+}
+
+func (j *RenewalJob) remind(user models.UserSchema, startDate, dueDate string) {
+	data := map[string]interface{}{
+		"Name":        user.Name,
+		"Sub":         user.Sub,
+		"Date":        startDate,
+		"Renewal":     dueDate,
+		"PaymentLink": j.paymentLink,
+	}
+	if user.Email != "" {
+		if err := j.notifier.Email(user.Email, notify.RenewalReminder, data); err != nil {
+			slog.Error("jobs: failed to queue renewal email", "student_id", user.ID, "error", err)
+		}
+	}
+	if user.Phone != "" {
+		if err := j.notifier.Text(user.Phone, notify.StudentRenewalReminder, data); err != nil {
+			slog.Error("jobs: failed to queue renewal message", "student_id", user.ID, "error", err)
+		}
+	}
+}
+
+// expire marks the student as expired and frees their slot on the mentor.
+func (j *RenewalJob) expire(db *gorm.DB, user models.UserSchema) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("expired", true).Error; err != nil {
+			return err
+		}
+		if user.Mentor == "" {
+			return nil
+		}
+		return tx.Model(&models.MentorSchema{}).
+			Where("name = ? AND onn > 0", user.Mentor).
+			Update("onn", gorm.Expr("onn - 1")).Error
+	})
+}
@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"guidance/tracing"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/codes"
+	"gorm.io/gorm"
+)
+
+// Scheduler runs jobs on cron schedules. Every run first takes a lease row
+// in the database so that only one replica executes a given tick.
+type Scheduler struct {
+	db     *gorm.DB
+	cron   *cron.Cron
+	holder string
+}
+
+func NewScheduler(db *gorm.DB) *Scheduler {
+	host, _ := os.Hostname()
+	loc, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		loc = time.Local
+	}
+	return &Scheduler{
+		db:     db,
+		cron:   cron.New(cron.WithLocation(loc)),
+		holder: fmt.Sprintf("%s-%d", host, os.Getpid()),
+	}
+}
+
+// Add registers fn to run on the standard five field cron spec. The lease is
+// held for ttl, which should exceed both the job's run time and the clock
+// skew between replicas. Each run gets a trace of its own, carried by the
+// context fn is given.
+func (s *Scheduler) Add(name, spec string, ttl time.Duration, fn func(context.Context) error) error {
+	_, err := s.cron.AddFunc(spec, func() {
+		ok, err := s.acquire(name, ttl)
+		if err != nil {
+			slog.Error("jobs: failed to acquire lease", "job", name, "error", err)
+			return
+		}
+		if !ok {
+			return
+		}
+		ctx, span := tracing.Tracer().Start(context.Background(), "job "+name)
+		defer span.End()
+		start := time.Now()
+		if err := fn(ctx); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			slog.Error("jobs: job failed", "job", name, "duration_ms", time.Since(start).Milliseconds(), "error", err)
+			return
+		}
+		slog.Info("jobs: job finished", "job", name, "duration_ms", time.Since(start).Milliseconds())
+	})
+	return err
+}
+
+// Start begins running the registered jobs in the background.
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Stop prevents further runs and waits for running jobs to complete.
+func (s *Scheduler) Stop() {
+	<-s.cron.Stop().Done()
+}
+
+// acquire takes the named lease if it is free, expired or already ours.
+func (s *Scheduler) acquire(name string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	result := s.db.Exec(`INSERT INTO job_leases (name, holder, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+		WHERE job_leases.expires_at < ? OR job_leases.holder = ?`,
+		name, s.holder, now.Add(ttl), now, s.holder)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"context"
+	"guidance/models"
+	"guidance/notify"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EscalationJob flags open tickets that passed their SLA deadline without a
+// mentor response and emails every owner about them.
+type EscalationJob struct {
+	db       *gorm.DB
+	notifier *notify.Service
+}
+
+func NewEscalationJob(db *gorm.DB, notifier *notify.Service) *EscalationJob {
+	return &EscalationJob{db: db, notifier: notifier}
+}
+
+func (j *EscalationJob) Run(ctx context.Context) error {
+	db := j.db.WithContext(ctx)
+	var tickets []models.Ticket
+	if err := db.Where("status = ? AND escalated = ? AND due_at < ?", models.TicketOpen, false, time.Now()).Find(&tickets).Error; err != nil {
+		return err
+	}
+	if len(tickets) == 0 {
+		return nil
+	}
+
+	var owners []models.OwnerSchema
+	if err := db.Find(&owners).Error; err != nil {
+		return err
+	}
+
+	for _, t := range tickets {
+		now := time.Now()
+		if err := db.Model(&t).Updates(map[string]interface{}{"escalated": true, "escalated_at": now}).Error; err != nil {
+			slog.Error("jobs: failed to escalate ticket", "ticket_id", t.ID, "error", err)
+			continue
+		}
+
+		var student models.UserSchema
+		var mentor models.MentorSchema
+		db.First(&student, t.StudentID)
+		db.First(&mentor, t.MentorID)
+		data := map[string]interface{}{
+			"ID":        t.ID,
+			"Title":     t.Title,
+			"Student":   student.Name,
+			"Mentor":    mentor.Name,
+			"DueAt":     t.DueAt.Format("02 Jan 15:04"),
+			"CreatedAt": t.CreatedAt.Format("02 Jan 15:04"),
+		}
+		for _, o := range owners {
+			if err := j.notifier.Email(o.Email, notify.TicketEscalated, data); err != nil {
+				slog.Error("jobs: failed to queue escalation email", "ticket_id", t.ID, "error", err)
+			}
+		}
+	}
+
+	slog.Info("jobs: escalated tickets", "count", len(tickets))
+	return nil
+}
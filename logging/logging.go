@@ -0,0 +1,71 @@
+// Package logging builds the server's structured logger and carries the
+// per-request logger through contexts.
+package logging
+
+import (
+	"context"
+	"guidance/config"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// New returns a logger writing text or JSON to w, with phone numbers and
+// email addresses masked wherever they appear as attribute values.
+func New(w io.Writer, cfg config.Logging) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.Level))
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+	if cfg.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// piiKeys are attribute keys whose values are always masked, matched
+// case-insensitively against the end of the key so "studentPhone" and
+// "to_email" are caught too.
+var piiKeys = []string{"phone", "email", "mobile", "to"}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() != slog.KindString {
+		return a
+	}
+	key := strings.ToLower(a.Key)
+	for _, pii := range piiKeys {
+		if key == pii || (len(pii) > 2 && strings.HasSuffix(key, pii)) {
+			return slog.String(a.Key, Mask(a.Value.String()))
+		}
+	}
+	return a
+}
+
+// Mask hides all but enough of an email address or phone number to tell
+// records apart: "r***@gmail.com", "******3210".
+func Mask(value string) string {
+	if value == "" {
+		return ""
+	}
+	if at := strings.LastIndex(value, "@"); at > 0 {
+		return value[:1] + "***" + value[at:]
+	}
+	if len(value) <= 4 {
+		return strings.Repeat("*", len(value))
+	}
+	return strings.Repeat("*", len(value)-4) + value[len(value)-4:]
+}
+
+type contextKey struct{}
+
+// WithLogger returns a context carrying logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger stored in ctx, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
@@ -1,48 +1,273 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"guidance/config"
 	"guidance/controllers"
+	"guidance/events"
+	"guidance/jobs"
+	"guidance/logging"
+	"guidance/metrics"
+	"guidance/middleware"
 	"guidance/models"
+	"guidance/notify"
+	"guidance/tracing"
+	"guidance/webhooks"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
-	config := cors.Config{
-		AllowOrigins:     []string{"*"}, // Allow from specific origin, use "*" to allow all
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Content-Type"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}
-	r := gin.Default()
-
-	// Use the CORS middleware with the configured settings
-	r.Use(cors.New(config))
-	models.ConnectDatabase()
-	r.GET("/data_without_mentor", controllers.UserWithoutMentor)
-	r.GET("/api/data", controllers.UserGet)                      //checked and Final
-	r.POST("/", controllers.UserPost)                            //checked and Final
-	r.GET("/api/mentorData", controllers.MentorGet)              //checked and Final
-	r.POST("/mentorData", controllers.MentorPost)                //checked and Final
-	r.POST("/student/:phone", controllers.MentorUpdate)          //checked and Final
-	r.POST("/api/update", controllers.MentorStudentUpdate)       //checked and Final
-	r.POST("/mentorupdate/:phone", controllers.MentorInfoUpdate) //checked
-	r.GET("/api/renrollData", controllers.RenrollDataGet)        //checked and Final
-	r.POST("/renrollment", controllers.RenrollDataPost)          //checked and Final
-	r.POST("/change-password", controllers.ChangePassword)       //checked and Final
-	r.GET("/api/ownerData", controllers.OwnerGet)                //checked and Final
-	r.POST("/ownerData", controllers.OwnerPost)                  //checked and Final
-	r.DELETE("/api/delete", controllers.DELETE)                  //checked and Final
-	r.POST("/api/finalMentor", controllers.FinalMentor)          //checked and Final
-	r.POST("/order", controllers.Order)
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Everything, including the background workers, logs through one
+	// structured logger that masks contact details
+	logger := logging.New(os.Stdout, cfg.Logging)
+	slog.SetDefault(logger)
+
+	// Spans go to the OTLP collector when one is configured and are dropped
+	// otherwise
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("failed to set up tracing", "error", err)
+	}
+
+	r := gin.New()
+	recovery := middleware.Recovery()
+
+	// Probes and the metrics scrape come first so CORS, rate limits and the
+	// access log never apply to them
+	r.GET("/healthz", recovery, controllers.Healthz)
+	r.GET("/readyz", recovery, controllers.Readyz)
+	r.GET("/metrics", recovery, controllers.Metrics)
+
+	// Behind a load balancer, list it here so rate limits and lockouts see
+	// the real client address from X-Forwarded-For. With no list gin would
+	// trust the header from anyone, so it is then ignored altogether.
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		fatal("invalid TRUSTED_PROXIES", "error", err)
+	}
+
+	// The dashboard only accepts its configured origins; the Razorpay webhook
+	// is called server to server and stays open
+	r.Use(otelgin.Middleware(cfg.Tracing.ServiceName))
+	r.Use(middleware.RequestID(logger))
+	r.Use(middleware.Metrics())
+	// Inside the request id, logging and metrics so a panic is reported
+	// like any other 500
+	r.Use(recovery)
+	r.Use(middleware.CORS(cfg.CORS, "/order"))
+
+	// A generous per-address limit on everything, and tighter ones on the
+	// routes that create data or check credentials
+	limiter := middleware.NewMemoryLimiter()
+	r.Use(middleware.RateLimit(limiter, "default", middleware.Rule{Limit: 300, Period: time.Minute}))
+	signupLimit := middleware.RateLimit(limiter, "signup", middleware.Rule{Limit: 5, Period: 10 * time.Minute})
+	credentialLimit := middleware.RateLimit(limiter, "credentials", middleware.Rule{Limit: 10, Period: 10 * time.Minute})
+	webhookLimit := middleware.RateLimit(limiter, "webhook", middleware.Rule{Limit: 120, Period: time.Minute})
+	accountLimit := middleware.RateLimit(limiter, "account", middleware.Rule{Limit: 60, Period: time.Minute})
+	if err := models.ConnectDatabase(cfg.Database); err != nil {
+		fatal("database unavailable", "error", err)
+	}
+	if err := models.DB1.Use(tracing.GormPlugin{}); err != nil {
+		fatal("failed to trace database queries", "error", err)
+	}
+	controllers.Setup(models.DB1, cfg)
+	if sqlDB, err := models.DB1.DB(); err == nil {
+		metrics.RegisterDB("main", sqlDB)
+	}
+	metrics.RegisterMentorCapacity(models.DB1)
+	events.Subscribe(metrics.RecordEvent)
+
+	// Notifications are queued in the outbox and sent by a background worker
+	notifier := notify.NewService(models.DB1, notify.NewTransport(cfg.Mail), notify.NewMessenger(cfg.Messaging))
+	notifier.Start()
+	controllers.SetNotifier(notifier)
+	controllers.SetOriginCheck(middleware.Origins(cfg.CORS.AllowedOrigins).Allows)
+
+	// Daily renewal reminders and expiry, run by one replica at a time
+	scheduler := jobs.NewScheduler(models.DB1)
+	if err := scheduler.Add("renewal", cfg.Jobs.RenewalSchedule, time.Hour, jobs.NewRenewalJob(models.DB1, notifier, cfg.Jobs).Run); err != nil {
+		fatal("invalid RENEWAL_JOB_SCHEDULE", "schedule", cfg.Jobs.RenewalSchedule, "error", err)
+	}
+	if err := scheduler.Add("ticket-escalation", "*/15 * * * *", 10*time.Minute, jobs.NewEscalationJob(models.DB1, notifier).Run); err != nil {
+		fatal("failed to schedule ticket escalation", "error", err)
+	}
+	scheduler.Start()
+
+	// Outbound webhooks, queued from the event bus and delivered in the background
+	dispatcher := webhooks.NewDispatcher(models.DB1)
+	events.Subscribe(dispatcher.Enqueue)
+	dispatcher.Start()
+
+	r.POST("/", signupLimit, controllers.UserPost)                          //checked and Final
+	r.POST("/renrollment", signupLimit, controllers.RenrollDataPost)        //checked and Final
+	r.POST("/change-password", credentialLimit, controllers.ChangePassword) //checked and Final
+	// Open only until the first owner exists, after that owners add owners
+	r.POST("/ownerData", controllers.RequireOwnerOrBootstrap(), controllers.OwnerPost) //checked and Final
+	r.POST("/order", webhookLimit, controllers.Order)
 	r.GET("/getkey", controllers.Key)
 	r.POST("/api/paymentverify", controllers.Verify)
-	r.GET("/api/mentdelete", controllers.DelMentorGet)
-	r.DELETE("/mentdelete", controllers.DelMentor)
+
+	// The owner dashboard, authenticated with the token from /auth/owner/login
+	// or /auth/owner/verify
+	r.GET("/data_without_mentor", controllers.RequireOwner(), controllers.UserWithoutMentor)
+	r.POST("/mentorData", controllers.RequireOwner(), controllers.MentorPost)                //checked and Final
+	r.POST("/student/:phone", controllers.RequireOwner(), controllers.MentorUpdate)          //checked and Final
+	r.POST("/mentorupdate/:phone", controllers.RequireOwner(), controllers.MentorInfoUpdate) //checked
+	r.DELETE("/mentdelete", controllers.RequireOwner(), controllers.DelMentor)
+	owner := r.Group("/api", controllers.RequireOwner())
+	owner.GET("/data", controllers.UserGet)                //checked and Final
+	owner.GET("/mentorData", controllers.MentorGet)        //checked and Final
+	owner.POST("/update", controllers.MentorStudentUpdate) //checked and Final
+	owner.GET("/renrollData", controllers.RenrollDataGet)  //checked and Final
+	owner.GET("/ownerData", controllers.OwnerGet)          //checked and Final
+	owner.DELETE("/delete", controllers.DELETE)            //checked and Final
+	owner.POST("/finalMentor", controllers.FinalMentor)    //checked and Final
+	owner.GET("/mentdelete", controllers.DelMentorGet)
+	owner.GET("/attendance", controllers.AttendanceGet)
+	owner.GET("/taskStats", controllers.TaskStatsGet)
+	owner.GET("/events", controllers.EventsStream)
+	owner.GET("/tickets", controllers.OwnerTicketsGet)
+	owner.GET("/tickets/:id", controllers.OwnerTicketGet)
+	owner.POST("/tickets/:id/replies", controllers.OwnerTicketReply)
+	owner.GET("/reports/enrollments", controllers.EnrollmentReport)
+	owner.GET("/reports/revenue", controllers.RevenueReport)
+	owner.GET("/reports/renewals", controllers.RenewalReport)
+	owner.GET("/reports/mentors", controllers.MentorPerformanceReport)
+	owner.GET("/mentors/:id/ratings", controllers.MentorRatingsGet)
+	owner.GET("/mentors/:id/ratings/trend", controllers.MentorRatingTrend)
+	owner.GET("/lockouts", controllers.LockoutsGet)
+	owner.POST("/lockouts/unlock", controllers.LockoutUnlock)
+	owner.GET("/webhooks", controllers.WebhookGet)
+	owner.POST("/webhooks", controllers.WebhookPost)
+	owner.DELETE("/webhooks/:id", controllers.WebhookDelete)
+	owner.GET("/webhooks/:id/deliveries", controllers.WebhookDeliveries)
+
+	r.GET("/api/attachments/:id", controllers.RequireAnySession(), controllers.TicketAttachmentGet)
+	r.POST("/auth/student/code", credentialLimit, controllers.StudentLoginRequest)
+	r.POST("/auth/student/verify", credentialLimit, controllers.StudentLoginVerify)
+	r.POST("/password-reset", credentialLimit, controllers.PasswordResetRequestPost)
+	r.POST("/password-reset/confirm", credentialLimit, controllers.PasswordResetConfirmPost)
+	r.POST("/auth/mentor/login", credentialLimit, controllers.MentorLoginPost)
+	r.POST("/auth/owner/login", credentialLimit, controllers.OwnerLogin)
+	r.POST("/auth/owner/verify", credentialLimit, controllers.OwnerLoginVerify)
+
+	// Owner account and 2FA management, authenticated with the token from
+	// /auth/owner/login or /auth/owner/verify
+	account := r.Group("/owner/account")
+	account.POST("/2fa/setup", controllers.RequireOwnerEnrollment(), accountLimit, controllers.TOTPSetup)
+	account.POST("/2fa/enable", controllers.RequireOwnerEnrollment(), accountLimit, controllers.TOTPEnable)
+	account.POST("/2fa/disable", controllers.RequireOwner(), accountLimit, controllers.TOTPDisable)
+	account.POST("/2fa/recovery-codes", controllers.RequireOwner(), accountLimit, controllers.RecoveryCodesPost)
+	account.POST("/logout", controllers.RequireOwnerEnrollment(), accountLimit, controllers.Logout)
+
+	// Student self-service, authenticated with the token from /auth/student/verify
+	me := r.Group("/me", controllers.RequireStudent(), accountLimit)
+	me.GET("", controllers.Me)
+	me.GET("/payments", controllers.MePayments)
+	me.POST("/contact", controllers.MeContactUpdate)
+	me.POST("/contact/verify", controllers.MeContactVerify)
+	me.POST("/logout", controllers.Logout)
+	me.GET("/chat/ws", controllers.StudentChatWS)
+	me.GET("/chat/messages", controllers.StudentChatHistory)
+	me.POST("/chat/read", controllers.StudentChatRead)
+	me.GET("/chat/unread", controllers.StudentChatUnread)
+	me.GET("/sessions.ics", controllers.StudentSessionsICS)
+	me.POST("/tests", controllers.StudentTestPost)
+	me.GET("/tests", controllers.StudentTestTrend)
+	me.GET("/plans", controllers.StudentPlansGet)
+	me.POST("/tasks/:taskId", controllers.StudentTaskUpdate)
+	me.POST("/tickets", controllers.TicketPost)
+	me.GET("/tickets", controllers.StudentTicketsGet)
+	me.GET("/tickets/:id", controllers.StudentTicketGet)
+	me.POST("/tickets/:id/replies", controllers.StudentTicketReply)
+	me.POST("/tickets/:id/close", controllers.StudentTicketClose)
+	me.POST("/ratings", controllers.RatingPost)
+
+	// Mentor workspace, authenticated with the token from /auth/mentor/login
+	mentor := r.Group("/mentor", controllers.RequireMentor(), accountLimit)
+	mentor.GET("/sessions", controllers.MentorSessionsGet)
+	mentor.POST("/sessions", controllers.SessionPost)
+	mentor.POST("/sessions/:id/reschedule", controllers.SessionReschedulePost)
+	mentor.POST("/sessions/:id/cancel", controllers.SessionCancelPost)
+	mentor.GET("/sessions.ics", controllers.MentorSessionsICS)
+	mentor.POST("/logs", controllers.SessionLogPost)
+	mentor.GET("/students/:id/logs", controllers.StudentLogsGet)
+	mentor.POST("/students/:id/tests", controllers.MentorTestPost)
+	mentor.GET("/tests/summary", controllers.MentorTestSummary)
+	mentor.GET("/students/:id/plans", controllers.MentorStudentPlansGet)
+	mentor.POST("/students/:id/plans", controllers.StudyPlanPost)
+	mentor.POST("/plans/:planId/tasks", controllers.StudyTaskPost)
+	mentor.GET("/taskStats", controllers.MentorTaskStatsGet)
+	mentor.GET("/tickets", controllers.MentorTicketsGet)
+	mentor.GET("/tickets/:id", controllers.MentorTicketGet)
+	mentor.POST("/tickets/:id/replies", controllers.MentorTicketReply)
+	mentor.POST("/tickets/:id/close", controllers.MentorTicketClose)
+	mentor.GET("/students/:id/chat/ws", controllers.MentorChatWS)
+	mentor.GET("/students/:id/chat/messages", controllers.MentorChatHistory)
+	mentor.POST("/students/:id/chat/read", controllers.MentorChatRead)
+	mentor.GET("/chat/unread", controllers.MentorChatUnread)
+	mentor.POST("/logout", controllers.Logout)
 	// Start the server
-	r.Run(":8080")
+	srv := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           r,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	go func() {
+		slog.Info("listening", "addr", cfg.Server.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("HTTP server failed", "error", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+
+	// Let in-flight requests such as payment webhooks finish, then stop the
+	// background workers, which each wait for their current batch
+	slog.Info("shutting down", "drain_timeout", cfg.Server.ShutdownTimeout.String())
+	controllers.Drain()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("HTTP server did not drain in time", "error", err)
+		srv.Close()
+	}
+	scheduler.Stop()
+	dispatcher.Stop()
+	notifier.Stop()
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("failed to flush traces", "error", err)
+	}
+	if sqlDB, err := models.DB1.DB(); err == nil {
+		sqlDB.Close()
+	}
+	slog.Info("shutdown complete")
+}
+
+// fatal logs at error level and exits, for startup failures after the
+// structured logger is in place
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
@@ -0,0 +1,115 @@
+// Package metrics defines the Prometheus metrics exported on /metrics.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"guidance/events"
+	"guidance/models"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency, by route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	Enrollments = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "guidance_enrollments_total",
+		Help: "Students enrolled, from payments or added from the dashboard.",
+	})
+
+	Reenrollments = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "guidance_reenrollments_total",
+		Help: "Students re-enrolled.",
+	})
+
+	Payments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "guidance_payments_total",
+		Help: "Razorpay payment events received, by outcome.",
+	}, []string{"status"})
+
+	SignatureFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "guidance_signature_failures_total",
+		Help: "Razorpay signatures that did not verify, by source.",
+	}, []string{"source"})
+)
+
+// ObserveRequest records one handled HTTP request.
+func ObserveRequest(method, route string, status int, took time.Duration) {
+	code := strconv.Itoa(status)
+	HTTPRequests.WithLabelValues(method, route, code).Inc()
+	HTTPDuration.WithLabelValues(method, route, code).Observe(took.Seconds())
+}
+
+// RecordEvent counts the business events published by the handlers. It is
+// subscribed to the event bus, so the handlers do not need to know about it.
+func RecordEvent(e events.Event) {
+	switch e.Type {
+	case events.StudentCreated:
+		Enrollments.Inc()
+	case events.StudentReenrolled:
+		Reenrollments.Inc()
+	}
+}
+
+// RegisterDB exports the connection pool stats of db under the given name.
+func RegisterDB(name string, db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterMentorCapacity exports how many students each mentor can take and
+// has on right now. The mentors are read at scrape time.
+func RegisterMentorCapacity(db *gorm.DB) {
+	prometheus.MustRegister(&mentorCollector{db: db})
+}
+
+var (
+	mentorCapacityDesc = prometheus.NewDesc("guidance_mentor_capacity",
+		"Students the mentor can handle at once.", []string{"mentor_id", "mentor"}, nil)
+	mentorActiveDesc = prometheus.NewDesc("guidance_mentor_active_students",
+		"Students currently assigned to the mentor.", []string{"mentor_id", "mentor"}, nil)
+	mentorTotalDesc = prometheus.NewDesc("guidance_mentor_students_total",
+		"Students ever assigned to the mentor.", []string{"mentor_id", "mentor"}, nil)
+)
+
+type mentorCollector struct {
+	db *gorm.DB
+}
+
+func (m *mentorCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- mentorCapacityDesc
+	ch <- mentorActiveDesc
+	ch <- mentorTotalDesc
+}
+
+func (m *mentorCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var mentors []models.MentorSchema
+	if err := m.db.WithContext(ctx).Select("id", "name", "handle", "onn", "total").Find(&mentors).Error; err != nil {
+		slog.Error("metrics: failed to load mentors", "error", err)
+		return
+	}
+	for _, ment := range mentors {
+		id := strconv.FormatUint(uint64(ment.ID), 10)
+		ch <- prometheus.MustNewConstMetric(mentorCapacityDesc, prometheus.GaugeValue, float64(ment.Handle), id, ment.Name)
+		ch <- prometheus.MustNewConstMetric(mentorActiveDesc, prometheus.GaugeValue, float64(ment.Onn), id, ment.Name)
+		ch <- prometheus.MustNewConstMetric(mentorTotalDesc, prometheus.GaugeValue, float64(ment.Total), id, ment.Name)
+	}
+}
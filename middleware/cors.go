@@ -0,0 +1,87 @@
+// Package middleware holds the gin middleware shared by every route.
+package middleware
+
+import (
+	"guidance/config"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// Origins is an allowlist of browser origins. Entries are exact origins
+// ("https://admin.example.com"), a leading wildcard subdomain
+// ("https://*.example.com") or "*" for any origin.
+type Origins []string
+
+// Allows reports whether origin is on the list.
+func (o Origins) Allows(origin string) bool {
+	origin = strings.ToLower(strings.TrimRight(origin, "/"))
+	for _, allowed := range o {
+		allowed = strings.ToLower(strings.TrimRight(allowed, "/"))
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		scheme, host, ok := strings.Cut(allowed, "://*.")
+		if !ok {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err == nil && u.Scheme == scheme && strings.HasSuffix(u.Host, "."+host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o Origins) any() bool {
+	for _, allowed := range o {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS applies the dashboard policy to every route except the public ones,
+// which accept requests from any origin without credentials. It has to be
+// installed with Use on the engine so preflight requests for routes that
+// only exist as POST or DELETE are answered too.
+func CORS(cfg config.CORS, publicPaths ...string) gin.HandlerFunc {
+	origins := Origins(cfg.AllowedOrigins)
+	credentials := cfg.AllowCredentials
+	if origins.any() && credentials {
+		// Browsers refuse credentials with a wildcard origin, and echoing
+		// any origin back instead would let every site act as the user.
+		slog.Warn("cors: credentials disabled because CORS_ALLOWED_ORIGINS contains *")
+		credentials = false
+	}
+	dashboard := cors.New(cors.Config{
+		AllowOriginFunc:  origins.Allows,
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     append([]string{"Content-Type", "Authorization"}, cfg.AllowedHeaders...),
+		ExposeHeaders:    []string{"Content-Length", "Content-Disposition", "Retry-After"},
+		AllowCredentials: credentials,
+		AllowWebSockets:  true,
+		MaxAge:           cfg.MaxAge,
+	})
+	public := cors.New(cors.Config{
+		AllowAllOrigins: true,
+		AllowMethods:    []string{"POST", "OPTIONS"},
+		AllowHeaders:    []string{"Content-Type", "X-Razorpay-Signature"},
+		MaxAge:          cfg.MaxAge,
+	})
+	paths := make(map[string]bool, len(publicPaths))
+	for _, path := range publicPaths {
+		paths[path] = true
+	}
+	return func(c *gin.Context) {
+		if paths[c.Request.URL.Path] {
+			public(c)
+			return
+		}
+		dashboard(c)
+	}
+}
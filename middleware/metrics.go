@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"guidance/metrics"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics counts every request and its latency by route template, so
+// /api/student/:id is one series however many students there are.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
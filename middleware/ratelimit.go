@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"guidance/logging"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rule is a token bucket: up to Limit requests at once, refilled at Limit
+// per Period.
+type Rule struct {
+	Limit  int
+	Period time.Duration
+}
+
+func (r Rule) perSecond() float64 {
+	return float64(r.Limit) / r.Period.Seconds()
+}
+
+// Result is the outcome of taking one token.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next token, when not allowed.
+	RetryAfter time.Duration
+}
+
+func newResult(rule Rule, tokens float64, allowed bool) Result {
+	rate := rule.perSecond()
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(rule.Limit) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return result
+}
+
+// Limiter stores the buckets. MemoryLimiter is enough for one instance;
+// RedisLimiter shares the buckets between replicas.
+type Limiter interface {
+	Take(ctx context.Context, key string, rule Rule) (Result, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket will have refilled, after which it can be
+	// dropped without changing any answer.
+	full time.Time
+}
+
+// MemoryLimiter keeps buckets in process memory.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: make(map[string]*bucket), lastSweep: time.Now(), now: time.Now}
+}
+
+func (m *MemoryLimiter) Take(_ context.Context, key string, rule Rule) (Result, error) {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) > time.Minute {
+		for k, b := range m.buckets {
+			if now.After(b.full) {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Limit), updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(rule.Limit), b.tokens+now.Sub(b.updated).Seconds()*rule.perSecond())
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	result := newResult(rule, b.tokens, allowed)
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+// RedisEvaler is the one call RedisLimiter needs from a Redis client. With
+// go-redis it is
+//
+//	func(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+//		return client.Eval(ctx, script, keys, args...).Result()
+//	}
+type RedisEvaler interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// RedisEvalFunc adapts a function to RedisEvaler.
+type RedisEvalFunc func(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+
+func (f RedisEvalFunc) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return f(ctx, script, keys, args...)
+}
+
+// tokenBucketScript refills and takes from the bucket atomically. Tokens
+// are returned as a string because Redis truncates Lua numbers to integers.
+const tokenBucketScript = `
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or limit
+local ts = tonumber(state[2]) or now
+tokens = math.min(limit, tokens + math.max(0, now - ts) * limit / period)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], period)
+return {allowed, tostring(tokens)}
+`
+
+// RedisLimiter keeps buckets in Redis or any server that speaks its
+// scripting commands, so every replica sees the same limits.
+type RedisLimiter struct {
+	client RedisEvaler
+	prefix string
+}
+
+func NewRedisLimiter(client RedisEvaler, prefix string) *RedisLimiter {
+	return &RedisLimiter{client: client, prefix: prefix}
+}
+
+func (r *RedisLimiter) Take(ctx context.Context, key string, rule Rule) (Result, error) {
+	reply, err := r.client.Eval(ctx, tokenBucketScript, []string{r.prefix + key},
+		rule.Limit, rule.Period.Milliseconds(), time.Now().UnixMilli())
+	if err != nil {
+		return Result{}, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	text, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("ratelimit: unexpected tokens %v", values[1])
+	}
+	return newResult(rule, tokens, allowed == 1), nil
+}
+
+// clientKey identifies the caller: the signed in account when an auth
+// middleware has run (it sets "sessionKind" and "principalID"), otherwise
+// the client address.
+func clientKey(c *gin.Context) string {
+	if kind := c.GetString("sessionKind"); kind != "" {
+		return kind + ":" + strconv.FormatUint(uint64(c.GetUint("principalID")), 10)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimit limits each client to rule on the routes it is attached to.
+// Policies with different names have separate buckets. The response carries
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, and
+// Retry-After when the request is refused. If the limiter fails the request
+// is let through.
+func RateLimit(limiter Limiter, name string, rule Rule) gin.HandlerFunc {
+	policy := fmt.Sprintf("%d;w=%d", rule.Limit, int(rule.Period.Seconds()))
+	return func(c *gin.Context) {
+		result, err := limiter.Take(c.Request.Context(), name+":"+clientKey(c), rule)
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Error("ratelimit: limiter failed, allowing request", "policy", name, "error", err)
+			c.Next()
+			return
+		}
+		c.Header("RateLimit-Policy", policy)
+		c.Header("RateLimit-Limit", strconv.Itoa(rule.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please slow down"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock is advanced by the tests instead of sleeping.
+type fakeClock struct{ t time.Time }
+
+func (f *fakeClock) now() time.Time { return f.t }
+
+func newTestLimiter() (*MemoryLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	m := NewMemoryLimiter()
+	m.now = clock.now
+	m.lastSweep = clock.t
+	return m, clock
+}
+
+func TestMemoryLimiterRefill(t *testing.T) {
+	// 5 requests per 10 seconds refills one token every 2 seconds.
+	rule := Rule{Limit: 5, Period: 10 * time.Second}
+	m, clock := newTestLimiter()
+
+	tests := []struct {
+		name      string
+		advance   time.Duration
+		allowed   bool
+		remaining int
+		reset     time.Duration
+		retry     time.Duration
+	}{
+		{"first request", 0, true, 4, 2 * time.Second, 0},
+		{"second", 0, true, 3, 4 * time.Second, 0},
+		{"third", 0, true, 2, 6 * time.Second, 0},
+		{"fourth", 0, true, 1, 8 * time.Second, 0},
+		{"fifth empties the bucket", 0, true, 0, 10 * time.Second, 0},
+		{"sixth is refused", 0, false, 0, 10 * time.Second, 2 * time.Second},
+		{"half a token is not enough", time.Second, false, 0, 9 * time.Second, time.Second},
+		{"a whole token refilled", time.Second, true, 0, 10 * time.Second, 0},
+		{"refill is capped at the limit", time.Hour, true, 4, 2 * time.Second, 0},
+	}
+	for _, tt := range tests {
+		clock.t = clock.t.Add(tt.advance)
+		got, err := m.Take(context.Background(), "ip:1.2.3.4", rule)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got.Allowed != tt.allowed || got.Remaining != tt.remaining || got.Reset != tt.reset || got.RetryAfter != tt.retry {
+			t.Errorf("%s: Take = %+v, want allowed %v, remaining %d, reset %v, retry after %v",
+				tt.name, got, tt.allowed, tt.remaining, tt.reset, tt.retry)
+		}
+	}
+}
+
+func TestMemoryLimiterKeysAreSeparate(t *testing.T) {
+	rule := Rule{Limit: 1, Period: time.Minute}
+	m, _ := newTestLimiter()
+
+	if r, _ := m.Take(context.Background(), "a", rule); !r.Allowed {
+		t.Fatal("first request for a was refused")
+	}
+	if r, _ := m.Take(context.Background(), "a", rule); r.Allowed {
+		t.Error("second request for a was allowed")
+	}
+	if r, _ := m.Take(context.Background(), "b", rule); !r.Allowed {
+		t.Error("b was limited by a's bucket")
+	}
+}
+
+func TestMemoryLimiterSweepsFullBuckets(t *testing.T) {
+	rule := Rule{Limit: 2, Period: 10 * time.Second}
+	m, clock := newTestLimiter()
+
+	m.Take(context.Background(), "old", rule)
+	clock.t = clock.t.Add(2 * time.Minute)
+	m.Take(context.Background(), "new", rule)
+
+	if _, ok := m.buckets["old"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+	if _, ok := m.buckets["new"]; !ok {
+		t.Error("bucket in use was swept")
+	}
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"guidance/logging"
+	"io"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Recovery turns a panic in a handler into a JSON 500. It must come after
+// RequestID, so the panic is logged with the request's id and the body
+// carries it for the user to quote.
+func Recovery() gin.HandlerFunc {
+	// gin's own stderr dump is discarded, the stack goes into the log line
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		logging.FromContext(c.Request.Context()).Error("panic while handling request",
+			"error", err, "stack", string(debug.Stack()))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	})
+}
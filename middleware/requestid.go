@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"guidance/logging"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID accepts ids a proxy or client might send without letting
+// arbitrary text into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// errorWriter adds "requestId" to JSON error bodies so a user reporting an
+// error can quote it.
+type errorWriter struct {
+	gin.ResponseWriter
+	id      string
+	written bool
+}
+
+func (w *errorWriter) Write(b []byte) (int, error) {
+	first := !w.written
+	w.written = true
+	if !first || w.Status() < 400 || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.ResponseWriter.Write(b)
+	}
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) < 2 || trimmed[0] != '{' {
+		return w.ResponseWriter.Write(b)
+	}
+	id, _ := json.Marshal(w.id)
+	out := append([]byte(`{"requestId":`), id...)
+	if body := bytes.TrimSpace(trimmed[1:]); body[0] != '}' {
+		out = append(out, ',')
+	}
+	out = append(out, trimmed[1:]...)
+	if _, err := w.ResponseWriter.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// RequestID gives every request an id, taken from X-Request-ID when the
+// caller sent a sensible one. The id is echoed in the response header,
+// added to JSON error bodies and attached to the request's logger, which
+// handlers get with logging.FromContext. Each request is logged once it
+// completes, with the route pattern rather than the raw path so phone
+// numbers in URLs stay out of the logs.
+func RequestID(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set("requestID", id)
+		c.Header(requestIDHeader, id)
+		c.Writer = &errorWriter{ResponseWriter: c.Writer, id: id}
+
+		reqLogger := logger.With("request_id", id)
+		// Tracing runs first, so the trace ids can go on every line too and
+		// the logs of a slow request can be found from its trace
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+			reqLogger = reqLogger.With("trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+		}
+		c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), reqLogger))
+
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		level := slog.LevelInfo
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		attrs := []any{
+			"method", c.Request.Method,
+			"route", route,
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+			"bytes", c.Writer.Size(),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "errors", c.Errors.String())
+		}
+		reqLogger.Log(c.Request.Context(), level, "request", attrs...)
+	}
+}
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// LoginCode is a one-time code sent to a student to sign in. Only the hash
+// of the code is stored.
+type LoginCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	StudentID uint       `json:"studentId" gorm:"index"`
+	Channel   string     `json:"channel"`
+	CodeHash  string     `json:"-"`
+	Attempts  int        `json:"attempts" gorm:"default:0"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// ContactChange is a pending change of a student's email or phone. Channel
+// is "email" or "sms" and Value the new address; it is applied once the code
+// sent to that address is confirmed. Only the hash of the code is stored.
+type ContactChange struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	StudentID uint       `json:"studentId" gorm:"index"`
+	Channel   string     `json:"channel"`
+	Value     string     `json:"value"`
+	CodeHash  string     `json:"-"`
+	Attempts  int        `json:"attempts" gorm:"default:0"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// LoginSession is a bearer token issued after a successful login. Kind is
+// the account type ("student", "mentor" or "owner") and PrincipalID the id
+// of the account's row. Only the hash of the token is stored.
+type LoginSession struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Kind        string    `json:"kind" gorm:"index:idx_login_sessions_principal"`
+	PrincipalID uint      `json:"principalId" gorm:"index:idx_login_sessions_principal"`
+	TokenHash   string    `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// PasswordReset is a single-use token mailed to a mentor or owner who forgot
+// their password. Kind is "mentor" or "owner". Only the hash of the token is
+// stored.
+type PasswordReset struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Kind        string     `json:"kind"`
+	PrincipalID uint       `json:"principalId"`
+	TokenHash   string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	UsedAt      *time.Time `json:"usedAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// RecoveryCode is a single-use code an owner can enter instead of a TOTP
+// code when they lose their authenticator. Only the hash is stored.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	OwnerID   uint       `json:"ownerId" gorm:"index"`
+	CodeHash  string     `json:"-" gorm:"uniqueIndex"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
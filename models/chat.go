@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// ChatMessage is one message between a student and their mentor. ReadAt is
+// set once the other side has seen it.
+type ChatMessage struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	StudentID uint       `json:"studentId" gorm:"index"`
+	MentorID  uint       `json:"mentorId" gorm:"index"`
+	Sender    string     `json:"sender"`
+	Body      string     `json:"body"`
+	ReadAt    *time.Time `json:"readAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// JobLease records which replica currently owns a scheduled job. A replica
+// may only run the job while it holds an unexpired lease.
+type JobLease struct {
+	Name      string    `json:"name" gorm:"primaryKey"`
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
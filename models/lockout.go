@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// CredentialFailure counts recent failed credential checks for one key,
+// either an account ("account:<kind>:<identifier>") or a client address
+// ("ip:<address>"). The row is deleted on a successful check or when an
+// owner unlocks the account.
+type CredentialFailure struct {
+	Key          string    `json:"key" gorm:"primaryKey"`
+	Failures     int       `json:"failures"`
+	LastFailedAt time.Time `json:"lastFailedAt"`
+}
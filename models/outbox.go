@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// OutboxMessage is a notification waiting to be delivered. Messages are
+// written by the request handlers and sent by the notify worker, so a send
+// that fails or is interrupted by a restart is retried later.
+type OutboxMessage struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Channel       string     `json:"channel" gorm:"default:email"`
+	Template      string     `json:"template"`
+	Recipient     string     `json:"recipient"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"body"`
+	Status        string     `json:"status" gorm:"index;default:pending"`
+	Attempts      int        `json:"attempts" gorm:"default:0"`
+	LastError     string     `json:"lastError"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt" gorm:"index"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	SentAt        *time.Time `json:"sentAt"`
+}
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
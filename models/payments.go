@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Payment is a captured Razorpay payment as received by the order webhook.
+// Amount is in paise.
+type Payment struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	PaymentID  string    `json:"paymentId" gorm:"uniqueIndex"`
+	OrderID    string    `json:"orderId"`
+	Amount     int64     `json:"amount"`
+	Currency   string    `json:"currency"`
+	Program    string    `json:"program"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	Phone      string    `json:"phone" gorm:"index"`
+	Status     string    `json:"status"`
+	CapturedAt time.Time `json:"capturedAt" gorm:"index"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// ReenrollmentLog keeps one row per re-enrollment. RenrollSchema only holds
+// the latest one per student, which is not enough for reporting.
+type ReenrollmentLog struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name"`
+	Phone     string    `json:"phone" gorm:"index"`
+	Date      string    `json:"date" gorm:"index"`
+	Class     string    `json:"class"`
+	Sub       string    `json:"sub"`
+	Mentor    string    `json:"mentor"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// StudyPlan is a mentor's plan for one student for the week starting on
+// WeekStart (YYYY-MM-DD).
+type StudyPlan struct {
+	ID        uint        `json:"id" gorm:"primaryKey"`
+	MentorID  uint        `json:"mentorId" gorm:"index"`
+	StudentID uint        `json:"studentId" gorm:"index;uniqueIndex:idx_study_plans_week,priority:1"`
+	WeekStart string      `json:"weekStart" gorm:"uniqueIndex:idx_study_plans_week,priority:2"`
+	Title     string      `json:"title"`
+	Tasks     []StudyTask `json:"tasks" gorm:"foreignKey:PlanID"`
+	CreatedAt time.Time   `json:"createdAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+}
+
+// StudyTask is a single item in a study plan.
+type StudyTask struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	PlanID      uint       `json:"planId" gorm:"index"`
+	Subject     string     `json:"subject"`
+	Chapter     string     `json:"chapter"`
+	Description string     `json:"description"`
+	DueDate     string     `json:"dueDate"`
+	Status      string     `json:"status" gorm:"default:pending"`
+	CompletedAt *time.Time `json:"completedAt"`
+}
+
+const (
+	TaskPending   = "pending"
+	TaskCompleted = "completed"
+)
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// MentorRating is a student's rating (1-5) of their mentor. Period is the
+// month (YYYY-MM) for periodic feedback; ratings given after a session carry
+// its SessionID instead.
+type MentorRating struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	MentorID  uint      `json:"mentorId" gorm:"index;uniqueIndex:idx_mentor_ratings_period,priority:1"`
+	StudentID uint      `json:"studentId" gorm:"index;uniqueIndex:idx_mentor_ratings_period,priority:2;uniqueIndex:idx_mentor_ratings_session,priority:2"`
+	SessionID *uint     `json:"sessionId" gorm:"index;uniqueIndex:idx_mentor_ratings_session,priority:1"`
+	Period    string    `json:"period" gorm:"uniqueIndex:idx_mentor_ratings_period,priority:3,where:period <> ''"`
+	Rating    int       `json:"rating"`
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Session is a mentoring session between a mentor and one of their assigned
+// students. Duration is in minutes.
+type Session struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	MentorID    uint      `json:"mentorId" gorm:"index"`
+	StudentID   uint      `json:"studentId" gorm:"index"`
+	ScheduledAt time.Time `json:"scheduledAt" gorm:"index"`
+	Duration    int       `json:"duration"`
+	Mode        string    `json:"mode"`
+	Status      string    `json:"status" gorm:"default:scheduled"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+const (
+	SessionScheduled = "scheduled"
+	SessionCancelled = "cancelled"
+	SessionCompleted = "completed"
+)
+
+// SessionLog is a mentor's record of what happened in a session: whether
+// the student showed up, how long it ran, what was covered and private
+// notes that are only shown back to the mentor.
+type SessionLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	SessionID  *uint     `json:"sessionId" gorm:"index"`
+	MentorID   uint      `json:"mentorId" gorm:"index"`
+	StudentID  uint      `json:"studentId" gorm:"index"`
+	Attendance string    `json:"attendance"`
+	Duration   int       `json:"duration"`
+	Topics     string    `json:"topics"`
+	Notes      string    `json:"notes"`
+	HeldAt     time.Time `json:"heldAt" gorm:"index"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+const (
+	Attended = "attended"
+	NoShow   = "no_show"
+)
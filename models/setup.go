@@ -1,10 +1,12 @@
 package models
 
 import (
-	"log"
-	"os"
-
-	"github.com/joho/godotenv"
+	"errors"
+	"fmt"
+	"guidance/config"
+	"log/slog"
+	"sync/atomic"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -13,14 +15,16 @@ import (
 var DB1 *gorm.DB
 
 type UserSchema struct {
-	ID     uint   `json:"id" gorm:"primaryKey"`
-	Name   string `json:"name"`
-	Phone  string `json:"phone"`
-	Email  string `json:"email"`
-	Date   string `json:"date"`
-	Class  string `json:"class"`
-	Sub    string `json:"sub"`
-	Mentor string `json:"mentorName"`
+	ID              uint   `json:"id" gorm:"primaryKey"`
+	Name            string `json:"name"`
+	Phone           string `json:"phone"`
+	Email           string `json:"email"`
+	Date            string `json:"date"`
+	Class           string `json:"class"`
+	Sub             string `json:"sub"`
+	Mentor          string `json:"mentorName"`
+	Expired         bool   `json:"expired" gorm:"default:false"`
+	ReminderSentFor string `json:"-" gorm:"default:"`
 }
 
 type MentorSchema struct {
@@ -54,55 +58,194 @@ type RenrollSchema struct {
 }
 
 type OwnerSchema struct {
-	ID        uint   `json:"id" gorm:"primaryKey"`
-	Email     string `json:"email"`
-	Password  string `json:"password"`
-	OwnerName string `json:"ownername"`
+	ID           uint   `json:"id" gorm:"primaryKey"`
+	Email        string `json:"email"`
+	Password     string `json:"-"`
+	OwnerName    string `json:"ownername"`
+	TotpSecret   string `json:"-"`
+	TotpEnabled  bool   `json:"totpEnabled" gorm:"default:false"`
+	TotpLastStep int64  `json:"-" gorm:"default:0"`
 }
 
-func init() {
-	// Load environment variables from .env file
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Error loading .env file")
+// ConnectDatabase opens the connection pool shared by the whole server,
+// retrying while the database starts up, and creates any missing tables.
+func ConnectDatabase(cfg config.Database) error {
+	var database *gorm.DB
+	var err error
+	for i := 0; i < cfg.ConnectRetries; i++ {
+		database, err = gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
+		if err == nil {
+			break
+		}
+		slog.Warn("Failed to connect to database", "attempt", i+1, "max_attempts", cfg.ConnectRetries, "error", err)
+		time.Sleep(2 * time.Second) // Wait before retrying
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to database after %d attempts: %w", cfg.ConnectRetries, err)
 	}
-}
-
-func ConnectDatabase() {
-
-	host := os.Getenv("DB_HOST")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbname := os.Getenv("DB_NAME")
-	port := os.Getenv("DB_PORT")
-
-	dsn := "host=" + host + " user=" + user + " password=" + password + " dbname=" + dbname + " port=" + port
-	database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{}) // change the database provider if necessary
 
+	sqlDB, err := database.DB()
 	if err != nil {
-		panic("Failed to connect to database!")
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	slog.Info("Successfully connected to the database")
+
+	// Every step is attempted so one broken table does not hide the rest, but
+	// the server does not start with a partial schema
+	var errs []error
+	migrate := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
 	}
 
 	// Check and create UserSchema table
 	if !database.Migrator().HasTable(&UserSchema{}) {
-		database.AutoMigrate(&UserSchema{})
+		migrate(database.AutoMigrate(&UserSchema{}))
+	}
+
+	// Columns added after the table was first created
+	for _, column := range []string{"Expired", "ReminderSentFor"} {
+		if !database.Migrator().HasColumn(&UserSchema{}, column) {
+			migrate(database.Migrator().AddColumn(&UserSchema{}, column))
+		}
 	}
 
 	// Check and create MentorSchema table
 	if !database.Migrator().HasTable(&MentorSchema{}) {
-		database.AutoMigrate(&MentorSchema{})
+		migrate(database.AutoMigrate(&MentorSchema{}))
 	}
 
 	if !database.Migrator().HasTable(&RenrollSchema{}) {
-		database.AutoMigrate(&RenrollSchema{})
+		migrate(database.AutoMigrate(&RenrollSchema{}))
 	}
 
 	if !database.Migrator().HasTable(&MentorLogin{}) {
-		database.AutoMigrate(&MentorLogin{})
+		migrate(database.AutoMigrate(&MentorLogin{}))
 	}
 
 	if !database.Migrator().HasTable(&OwnerSchema{}) {
-		database.AutoMigrate(&OwnerSchema{})
+		migrate(database.AutoMigrate(&OwnerSchema{}))
+	}
+
+	for _, column := range []string{"TotpSecret", "TotpEnabled", "TotpLastStep"} {
+		if !database.Migrator().HasColumn(&OwnerSchema{}, column) {
+			migrate(database.Migrator().AddColumn(&OwnerSchema{}, column))
+		}
+	}
+
+	if !database.Migrator().HasTable(&OutboxMessage{}) {
+		migrate(database.AutoMigrate(&OutboxMessage{}))
+	}
+
+	if !database.Migrator().HasTable(&JobLease{}) {
+		migrate(database.AutoMigrate(&JobLease{}))
+	}
+
+	if !database.Migrator().HasTable(&WebhookSubscription{}) {
+		migrate(database.AutoMigrate(&WebhookSubscription{}))
+	}
+
+	if !database.Migrator().HasTable(&WebhookDelivery{}) {
+		migrate(database.AutoMigrate(&WebhookDelivery{}))
+	}
+
+	if !database.Migrator().HasTable(&Session{}) {
+		migrate(database.AutoMigrate(&Session{}))
+	}
+
+	if !database.Migrator().HasTable(&SessionLog{}) {
+		migrate(database.AutoMigrate(&SessionLog{}))
+	}
+
+	if !database.Migrator().HasTable(&TestScore{}) {
+		migrate(database.AutoMigrate(&TestScore{}))
+	}
+
+	if !database.Migrator().HasTable(&StudyPlan{}) {
+		migrate(database.AutoMigrate(&StudyPlan{}))
+	}
+
+	if !database.Migrator().HasIndex(&StudyPlan{}, "idx_study_plans_week") {
+		migrate(database.Migrator().CreateIndex(&StudyPlan{}, "idx_study_plans_week"))
+	}
+
+	if !database.Migrator().HasTable(&StudyTask{}) {
+		migrate(database.AutoMigrate(&StudyTask{}))
+	}
+
+	if !database.Migrator().HasTable(&Ticket{}) {
+		migrate(database.AutoMigrate(&Ticket{}))
+	}
+
+	if !database.Migrator().HasTable(&TicketReply{}) {
+		migrate(database.AutoMigrate(&TicketReply{}))
+	}
+
+	if !database.Migrator().HasTable(&TicketAttachment{}) {
+		migrate(database.AutoMigrate(&TicketAttachment{}))
+	}
+
+	if !database.Migrator().HasTable(&ChatMessage{}) {
+		migrate(database.AutoMigrate(&ChatMessage{}))
+	}
+
+	if !database.Migrator().HasTable(&Payment{}) {
+		migrate(database.AutoMigrate(&Payment{}))
+	}
+
+	if !database.Migrator().HasTable(&ReenrollmentLog{}) {
+		migrate(database.AutoMigrate(&ReenrollmentLog{}))
+	}
+
+	if !database.Migrator().HasTable(&MentorRating{}) {
+		migrate(database.AutoMigrate(&MentorRating{}))
+	}
+
+	// One rating per student, mentor and month, and one per session
+	for _, index := range []string{"idx_mentor_ratings_period", "idx_mentor_ratings_session"} {
+		if !database.Migrator().HasIndex(&MentorRating{}, index) {
+			migrate(database.Migrator().CreateIndex(&MentorRating{}, index))
+		}
+	}
+
+	if !database.Migrator().HasTable(&LoginCode{}) {
+		migrate(database.AutoMigrate(&LoginCode{}))
+	}
+
+	if !database.Migrator().HasTable(&ContactChange{}) {
+		migrate(database.AutoMigrate(&ContactChange{}))
+	}
+
+	if !database.Migrator().HasTable(&LoginSession{}) {
+		migrate(database.AutoMigrate(&LoginSession{}))
+	}
+
+	if !database.Migrator().HasTable(&PasswordReset{}) {
+		migrate(database.AutoMigrate(&PasswordReset{}))
+	}
+
+	if !database.Migrator().HasTable(&CredentialFailure{}) {
+		migrate(database.AutoMigrate(&CredentialFailure{}))
+	}
+
+	if !database.Migrator().HasTable(&RecoveryCode{}) {
+		migrate(database.AutoMigrate(&RecoveryCode{}))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to migrate database: %w", errors.Join(errs...))
 	}
 	DB1 = database
+	migrated.Store(true)
+	return nil
+}
+
+var migrated atomic.Bool
 
+// Migrated reports whether ConnectDatabase has finished creating the tables.
+func Migrated() bool {
+	return migrated.Load()
 }
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// TestScore is one subject's result in a mock test. A full JEE mock produces
+// one row per subject sharing TestName and Date.
+type TestScore struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	StudentID  uint      `json:"studentId" gorm:"index"`
+	TestName   string    `json:"testName"`
+	Subject    string    `json:"subject"`
+	Score      float64   `json:"score"`
+	MaxScore   float64   `json:"maxScore"`
+	Percentile float64   `json:"percentile"`
+	Date       string    `json:"date" gorm:"index"`
+	RecordedBy string    `json:"recordedBy"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Ticket is a doubt or support request raised by a student. It is routed to
+// the mentor assigned at the time it is opened. DueAt is the SLA deadline
+// for the mentor's next response while the ticket is open.
+type Ticket struct {
+	ID          uint               `json:"id" gorm:"primaryKey"`
+	StudentID   uint               `json:"studentId" gorm:"index"`
+	MentorID    uint               `json:"mentorId" gorm:"index"`
+	Subject     string             `json:"subject"`
+	Title       string             `json:"title"`
+	Status      string             `json:"status" gorm:"index;default:open"`
+	DueAt       time.Time          `json:"dueAt" gorm:"index"`
+	Escalated   bool               `json:"escalated" gorm:"default:false"`
+	EscalatedAt *time.Time         `json:"escalatedAt"`
+	Replies     []TicketReply      `json:"replies,omitempty"`
+	Attachments []TicketAttachment `json:"attachments,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt"`
+}
+
+// TicketReply is one message in a ticket thread. The opening message of a
+// ticket is stored as its first reply.
+type TicketReply struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	TicketID  uint      `json:"ticketId" gorm:"index"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TicketAttachment points at a file kept in the blob store.
+type TicketAttachment struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	TicketID    uint      `json:"ticketId" gorm:"index"`
+	ReplyID     uint      `json:"replyId"`
+	FileName    string    `json:"fileName"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	BlobKey     string    `json:"-"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+const (
+	TicketOpen     = "open"
+	TicketAnswered = "answered"
+	TicketClosed   = "closed"
+)
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// WebhookSubscription is an owner registered endpoint that receives the
+// listed event types. Events is a comma separated list, "*" matches all.
+type WebhookSubscription struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    string    `json:"events"`
+	Active    bool      `json:"active" gorm:"default:true"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookDelivery is one attempt series to deliver an event to a
+// subscription. It doubles as the delivery log.
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	SubscriptionID uint       `json:"subscriptionId" gorm:"index"`
+	EventID        string     `json:"eventId"`
+	EventType      string     `json:"eventType"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status" gorm:"index;default:pending"`
+	Attempts       int        `json:"attempts" gorm:"default:0"`
+	ResponseStatus int        `json:"responseStatus"`
+	LastError      string     `json:"lastError"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt" gorm:"index"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt"`
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
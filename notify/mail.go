@@ -0,0 +1,180 @@
+package notify
+
+import (
+	"crypto/tls"
+	"fmt"
+	"guidance/config"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a single rendered email ready to hand to a Transport.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Transport delivers a rendered Message. Implementations must be safe for
+// concurrent use.
+type Transport interface {
+	Send(msg Message) error
+}
+
+// SMTPTransport sends mail through a plain SMTP relay using PLAIN auth.
+type SMTPTransport struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (t *SMTPTransport) Send(msg Message) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("From: " + t.From + "\r\n")
+	b.WriteString("To: " + to.Address + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", headerValue(msg.Subject)) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+
+	return t.send(to.Address, []byte(b.String()))
+}
+
+// send is smtp.SendMail with a deadline on the whole conversation, so a
+// relay that stops answering cannot stall the outbox worker.
+func (t *SMTPTransport) send(to string, data []byte) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(t.Host, t.Port), sendTimeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(sendTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: t.Host}); err != nil {
+			return err
+		}
+	}
+	if t.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", t.Username, t.Password, t.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(t.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// FileTransport writes every message as a .eml file into Dir. It is meant for
+// local development where no SMTP relay is available.
+type FileTransport struct {
+	Dir string
+}
+
+func (t *FileTransport) Send(msg Message) error {
+	if err := os.MkdirAll(t.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitize(msg.To))
+	content := "To: " + headerValue(msg.To) + "\nSubject: " + headerValue(msg.Subject) + "\n\n" + msg.Body
+	return os.WriteFile(filepath.Join(t.Dir, name), []byte(content), 0o644)
+}
+
+// headerValue drops line breaks so a value taken from user input, such as a
+// name in the subject, cannot start a header of its own.
+func headerValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// MemoryTransport keeps sent messages in memory so tests can inspect them.
+type MemoryTransport struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (t *MemoryTransport) Send(msg Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sent = append(t.sent, msg)
+	return nil
+}
+
+// Sent returns a copy of every message delivered so far.
+func (t *MemoryTransport) Sent() []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Message, len(t.sent))
+	copy(out, t.sent)
+	return out
+}
+
+// NewTransport returns the configured mail transport: "smtp", "file" or
+// "memory".
+func NewTransport(cfg config.Mail) Transport {
+	switch cfg.Transport {
+	case "smtp":
+		return &SMTPTransport{
+			Host:     cfg.SMTPHost,
+			Port:     strconv.Itoa(cfg.SMTPPort),
+			Username: cfg.SMTPUser,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}
+	case "memory":
+		return &MemoryTransport{}
+	default:
+		return &FileTransport{Dir: cfg.FileDir}
+	}
+}
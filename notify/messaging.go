@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"guidance/config"
+	"guidance/tracing"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Messenger delivers a short text message to a phone number over a
+// messaging channel such as WhatsApp or SMS.
+type Messenger interface {
+	// Channel names the channel, and is stored on outbox rows so the worker
+	// knows where to route them.
+	Channel() string
+	SendText(phone, text string) error
+}
+
+var httpClient = &http.Client{Timeout: sendTimeout, Transport: tracing.Transport(nil)}
+
+// WhatsAppMessenger sends free-form text messages through the WhatsApp
+// Business Cloud API.
+type WhatsAppMessenger struct {
+	PhoneNumberID string
+	Token         string
+	BaseURL       string
+}
+
+func (m *WhatsAppMessenger) Channel() string { return "whatsapp" }
+
+func (m *WhatsAppMessenger) SendText(phone, text string) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"to":                normalizePhone(phone),
+		"type":              "text",
+		"text":              map[string]string{"body": text},
+	})
+	if err != nil {
+		return err
+	}
+	base := m.BaseURL
+	if base == "" {
+		base = "https://graph.facebook.com/v19.0"
+	}
+	req, err := http.NewRequest(http.MethodPost, base+"/"+m.PhoneNumberID+"/messages", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.Token)
+	req.Header.Set("Content-Type", "application/json")
+	return doRequest(req)
+}
+
+// TwilioSMSMessenger sends plain SMS through the Twilio Messages API.
+type TwilioSMSMessenger struct {
+	AccountSID string
+	AuthToken  string
+	From       string
+}
+
+func (m *TwilioSMSMessenger) Channel() string { return "sms" }
+
+func (m *TwilioSMSMessenger) SendText(phone, text string) error {
+	form := url.Values{}
+	form.Set("To", "+"+normalizePhone(phone))
+	form.Set("From", m.From)
+	form.Set("Body", text)
+	endpoint := "https://api.twilio.com/2010-04-01/Accounts/" + m.AccountSID + "/Messages.json"
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(m.AccountSID, m.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doRequest(req)
+}
+
+func doRequest(req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("provider returned %s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+// FakeMessenger records messages in memory and logs that they were sent
+// instead of sending them.
+// It is the default when no provider is configured.
+type FakeMessenger struct {
+	mu   sync.Mutex
+	sent []TextMessage
+}
+
+// TextMessage is a message captured by FakeMessenger.
+type TextMessage struct {
+	Phone string
+	Text  string
+}
+
+func (m *FakeMessenger) Channel() string { return "whatsapp" }
+
+func (m *FakeMessenger) SendText(phone, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, TextMessage{Phone: phone, Text: text})
+	// The text may hold a login code, so only its size is logged
+	slog.Info("notify: fake message", "phone", phone, "length", len(text))
+	return nil
+}
+
+// Sent returns a copy of every message captured so far.
+func (m *FakeMessenger) Sent() []TextMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]TextMessage, len(m.sent))
+	copy(out, m.sent)
+	return out
+}
+
+// normalizePhone strips everything but digits and prefixes the Indian
+// country code to bare ten digit numbers, which is how phones are stored.
+func normalizePhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	if len(digits) == 10 {
+		return "91" + digits
+	}
+	return digits
+}
+
+// NewMessenger returns the configured messaging provider: "whatsapp",
+// "twilio" or "fake".
+func NewMessenger(cfg config.Messaging) Messenger {
+	switch cfg.Provider {
+	case "whatsapp":
+		return &WhatsAppMessenger{
+			PhoneNumberID: cfg.WhatsAppPhoneNumberID,
+			Token:         cfg.WhatsAppToken,
+		}
+	case "twilio":
+		return &TwilioSMSMessenger{
+			AccountSID: cfg.TwilioAccountSID,
+			AuthToken:  cfg.TwilioAuthToken,
+			From:       cfg.TwilioFrom,
+		}
+	default:
+		return &FakeMessenger{}
+	}
+}
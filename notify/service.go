@@ -0,0 +1,207 @@
+package notify
+
+import (
+	"context"
+	"guidance/models"
+	"guidance/tracing"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxAttempts = 5
+	batchSize   = 20
+	// sendTimeout bounds one SMTP conversation or messaging API call.
+	sendTimeout = 15 * time.Second
+	// claimLease keeps a claimed batch away from other replicas while it is
+	// being sent. It covers every send in a batch timing out; if the worker
+	// dies the messages become due again once it expires.
+	claimLease = batchSize*sendTimeout + time.Minute
+)
+
+// Service renders notifications into the outbox table and runs the worker
+// that drains it.
+type Service struct {
+	db        *gorm.DB
+	mail      Transport
+	messenger Messenger
+	interval  time.Duration
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewService(db *gorm.DB, mail Transport, messenger Messenger) *Service {
+	return &Service{
+		db:        db,
+		mail:      mail,
+		messenger: messenger,
+		interval:  10 * time.Second,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Email renders the named template and queues it for delivery to the given
+// address.
+func (s *Service) Email(to, tmpl string, data interface{}) error {
+	subject, body, err := Render(tmpl, data)
+	if err != nil {
+		return err
+	}
+	msg := models.OutboxMessage{
+		Channel:       "email",
+		Template:      tmpl,
+		Recipient:     to,
+		Subject:       subject,
+		Body:          body,
+		Status:        models.OutboxPending,
+		NextAttemptAt: time.Now(),
+	}
+	return s.enqueue(&msg)
+}
+
+// Text renders the named text template and queues it for delivery to the
+// given phone number over the configured messaging channel.
+func (s *Service) Text(phone, tmpl string, data interface{}) error {
+	body, err := RenderText(tmpl, data)
+	if err != nil {
+		return err
+	}
+	msg := models.OutboxMessage{
+		Channel:       s.messenger.Channel(),
+		Template:      tmpl,
+		Recipient:     phone,
+		Body:          body,
+		Status:        models.OutboxPending,
+		NextAttemptAt: time.Now(),
+	}
+	return s.enqueue(&msg)
+}
+
+// enqueue stores msg and nudges the worker so time sensitive messages such
+// as login codes do not wait for the next poll.
+func (s *Service) enqueue(msg *models.OutboxMessage) error {
+	if err := s.db.Create(msg).Error; err != nil {
+		return err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start launches the outbox worker in the background.
+func (s *Service) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			s.flush()
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			case <-s.wake:
+			}
+		}
+	}()
+}
+
+// Stop signals the worker to exit and waits for the current batch to finish.
+func (s *Service) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+}
+
+// flush sends one batch of due messages. The batch is claimed in a short
+// transaction, with SKIP LOCKED so replicas do not pick the same rows, and
+// the messages are sent after it commits so a slow relay never holds row
+// locks or a database connection.
+func (s *Service) flush() {
+	batch, err := s.claim()
+	if err != nil {
+		slog.Error("notify: failed to claim outbox messages", "error", err)
+		return
+	}
+
+	for i := range batch {
+		s.send(&batch[i])
+	}
+}
+
+// claim picks the due messages and pushes their next attempt past the lease,
+// which is what keeps other workers off them.
+func (s *Service) claim() ([]models.OutboxMessage, error) {
+	var batch []models.OutboxMessage
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.OutboxPending, time.Now()).
+			Order("id").Limit(batchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(batch))
+		for i, msg := range batch {
+			ids[i] = msg.ID
+		}
+		return tx.Model(&models.OutboxMessage{}).Where("id IN ?", ids).
+			Update("next_attempt_at", time.Now().Add(claimLease)).Error
+	})
+	return batch, err
+}
+
+// send makes one attempt at the message and records the outcome. Each
+// message gets a trace of its own, so an idle poll records nothing.
+func (s *Service) send(msg *models.OutboxMessage) {
+	ctx, span := tracing.Tracer().Start(context.Background(), "notify.deliver",
+		trace.WithAttributes(attribute.String("notify.channel", msg.Channel), attribute.String("notify.template", msg.Template)))
+	defer span.End()
+
+	if err := s.deliver(*msg); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		msg.Attempts++
+		msg.LastError = err.Error()
+		if msg.Attempts >= maxAttempts {
+			msg.Status = models.OutboxFailed
+		} else {
+			backoff := time.Duration(msg.Attempts*msg.Attempts) * time.Minute
+			msg.NextAttemptAt = time.Now().Add(backoff)
+		}
+		slog.Warn("notify: sending outbox message failed", "message_id", msg.ID, "attempt", msg.Attempts, "error", err)
+	} else {
+		now := time.Now()
+		msg.Status = models.OutboxSent
+		msg.SentAt = &now
+		msg.LastError = ""
+	}
+	if sensitive[msg.Template] && msg.Status != models.OutboxPending {
+		msg.Subject, msg.Body = "", ""
+	}
+	if err := s.db.WithContext(ctx).Save(msg).Error; err != nil {
+		slog.Error("notify: failed to record outbox message", "message_id", msg.ID, "error", err)
+	}
+}
+
+func (s *Service) deliver(msg models.OutboxMessage) error {
+	if msg.Channel == "email" {
+		return s.mail.Send(Message{To: msg.Recipient, Subject: msg.Subject, Body: msg.Body})
+	}
+	return s.messenger.SendText(msg.Recipient, msg.Body)
+}
@@ -0,0 +1,220 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Template names accepted by Service.Email.
+const (
+	Welcome         = "welcome"
+	PaymentReceipt  = "payment_receipt"
+	MentorAssigned  = "mentor_assigned"
+	RenewalReminder = "renewal_reminder"
+	PasswordChanged = "password_changed"
+	TicketOpened    = "ticket_opened"
+	TicketEscalated = "ticket_escalated"
+	RatingAlert     = "rating_alert"
+	LoginCode       = "login_code"
+	PasswordReset   = "password_reset"
+	ContactCode     = "contact_code"
+)
+
+// Template names accepted by Service.Text.
+const (
+	StudentMentorAssigned  = "student_mentor_assigned"
+	StudentRenewalReminder = "student_renewal_reminder"
+	StudentLoginCode       = "student_login_code"
+	StudentContactCode     = "student_contact_code"
+)
+
+// sensitive lists the templates whose rendered text carries a secret, such
+// as a login code or reset link. Their subject and body are cleared from the
+// outbox once the message is sent or given up on.
+var sensitive = map[string]bool{
+	LoginCode:          true,
+	PasswordReset:      true,
+	ContactCode:        true,
+	StudentLoginCode:   true,
+	StudentContactCode: true,
+}
+
+type mailTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+var templates = map[string]mailTemplate{
+	Welcome: parse(
+		"Welcome to JEE Simplified, {{.Name}}",
+		`Hi {{.Name}},
+
+Thank you for enrolling in the {{.Sub}} guidance program for class {{.Class}}.
+We will assign you a mentor shortly and share their details with you.
+
+Team JEE Simplified
+`),
+	PaymentReceipt: parse(
+		"Payment receipt {{.PaymentID}}",
+		`Hi {{.Name}},
+
+We have received your payment{{if .Amount}} of Rs. {{.Amount}}{{end}} for the {{.Sub}} program.
+
+Payment ID: {{.PaymentID}}
+Date:       {{.Date}}
+
+Team JEE Simplified
+`),
+	MentorAssigned: parse(
+		"New students assigned to you",
+		`Hi {{.Mentor}},
+
+The following students have been assigned to you:
+{{range .Students}}
+  - {{.Name}} ({{.Phone}}, {{.Email}}), class {{.Class}}, {{.Sub}}{{end}}
+
+Please reach out to them within the next 24 hours.
+
+Team JEE Simplified
+`),
+	RenewalReminder: parse(
+		"Your guidance plan renews on {{.Renewal}}",
+		`Hi {{.Name}},
+
+Your {{.Sub}} guidance plan started on {{.Date}} and is due for renewal on {{.Renewal}}.
+{{if .PaymentLink}}
+You can renew here: {{.PaymentLink}}
+{{end}}
+Team JEE Simplified
+`),
+	PasswordChanged: parse(
+		"Your password was changed",
+		`Hi {{.Name}},
+
+The password for your account was just changed. If this was not you,
+contact the JEE Simplified team immediately.
+
+Team JEE Simplified
+`),
+	TicketOpened: parse(
+		"New doubt from {{.Student}}: {{.Title}}",
+		`Hi {{.Mentor}},
+
+{{.Student}} has raised a new {{if .Subject}}{{.Subject}} {{end}}doubt:
+
+{{.Title}}
+
+{{.Body}}
+
+Please reply by {{.DueAt}}.
+
+Team JEE Simplified
+`),
+	TicketEscalated: parse(
+		"Escalated: doubt #{{.ID}} has not been answered",
+		`Hello,
+
+Doubt #{{.ID}} "{{.Title}}" from {{.Student}} was routed to {{.Mentor}}
+and has not been answered by its deadline of {{.DueAt}}.
+
+Opened: {{.CreatedAt}}
+
+Team JEE Simplified
+`),
+	RatingAlert: parse(
+		"{{.Mentor}}'s rating dropped to {{printf \"%.1f\" .Average}}",
+		`Hello,
+
+The average rating of mentor {{.Mentor}} over the last {{.Days}} days has dropped
+to {{printf "%.1f" .Average}} from {{.Count}} ratings, below the alert threshold of {{printf "%.1f" .Threshold}}.
+
+Latest feedback: {{if .Comment}}"{{.Comment}}"{{else}}(no comment){{end}}
+
+Team JEE Simplified
+`),
+	LoginCode: parse(
+		"Your JEE Simplified login code is {{.Code}}",
+		`Hi {{.Name}},
+
+Your login code is {{.Code}}. It expires in {{.Minutes}} minutes.
+
+If you did not try to sign in, you can ignore this email.
+
+Team JEE Simplified
+`),
+	PasswordReset: parse(
+		"Reset your JEE Simplified password",
+		`Hi {{.Name}},
+
+We received a request to reset your password. Use the link below to choose
+a new one. It expires in {{.Minutes}} minutes and can only be used once.
+
+{{.Link}}
+
+If you did not ask for this, you can ignore this email and your password
+will stay the same.
+
+Team JEE Simplified
+`),
+	ContactCode: parse(
+		"Confirm your new JEE Simplified email address",
+		`Hi {{.Name}},
+
+Use the code {{.Code}} to confirm this address for your JEE Simplified
+account. It expires in {{.Minutes}} minutes.
+
+If you did not ask to change your contact details, you can ignore this
+email and your account will stay the same.
+
+Team JEE Simplified
+`),
+}
+
+var texts = map[string]*template.Template{
+	StudentMentorAssigned: template.Must(template.New(StudentMentorAssigned).Parse(
+		"Hi {{.Name}}, your JEE Simplified mentor is {{.Mentor}}. You can reach them on {{.MentorPhone}}. They will contact you soon.")),
+	StudentRenewalReminder: template.Must(template.New(StudentRenewalReminder).Parse(
+		"Hi {{.Name}}, your JEE Simplified {{.Sub}} plan is due for renewal on {{.Renewal}}.{{if .PaymentLink}} Renew here: {{.PaymentLink}}{{end}}")),
+	StudentLoginCode: template.Must(template.New(StudentLoginCode).Parse(
+		"{{.Code}} is your JEE Simplified login code. It expires in {{.Minutes}} minutes. Do not share it with anyone.")),
+	StudentContactCode: template.Must(template.New(StudentContactCode).Parse(
+		"{{.Code}} is your code to confirm this number for your JEE Simplified account. It expires in {{.Minutes}} minutes. If you did not ask for this, ignore this message.")),
+}
+
+func parse(subject, body string) mailTemplate {
+	return mailTemplate{
+		subject: template.Must(template.New("subject").Parse(subject)),
+		body:    template.Must(template.New("body").Parse(body)),
+	}
+}
+
+// Render executes the named template with data and returns the subject and
+// body of the email.
+func Render(name string, data interface{}) (string, string, error) {
+	t, ok := templates[name]
+	if !ok {
+		return "", "", fmt.Errorf("notify: unknown template %q", name)
+	}
+	var subject, body strings.Builder
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return "", "", err
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return "", "", err
+	}
+	return subject.String(), body.String(), nil
+}
+
+// RenderText executes the named text message template with data.
+func RenderText(name string, data interface{}) (string, error) {
+	t, ok := texts[name]
+	if !ok {
+		return "", fmt.Errorf("notify: unknown text template %q", name)
+	}
+	var body strings.Builder
+	if err := t.Execute(&body, data); err != nil {
+		return "", err
+	}
+	return body.String(), nil
+}
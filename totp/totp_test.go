@@ -0,0 +1,99 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// The RFC 6238 appendix B secret for SHA1, base32 encoded.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeRFC6238(t *testing.T) {
+	// The RFC lists 8 digit codes; 6 digit codes are their last six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	code := func(s int64) string {
+		c, err := Code(rfcSecret, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfcSecret, code(step), step, true},
+		{"previous step", rfcSecret, code(step - 1), step - 1, true},
+		{"next step", rfcSecret, code(step + 1), step + 1, true},
+		{"two steps old", rfcSecret, code(step - 2), 0, false},
+		{"spaces ignored", rfcSecret, " " + code(step)[:3] + " " + code(step)[3:], step, true},
+		{"lower case secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code(step), step, true},
+		{"too short", rfcSecret, code(step)[:5], 0, false},
+		{"wrong code", rfcSecret, "000000", 0, false},
+		{"bad secret", "not base32!", "123456", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Validate(tt.secret, tt.code, now)
+			if ok != tt.wantOK || got != tt.wantStep {
+				t.Errorf("Validate = (%d, %v), want (%d, %v)", got, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateAfterRejectsReplay(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := Step(now)
+	current, _ := Code(rfcSecret, step)
+	previous, _ := Code(rfcSecret, step-1)
+
+	tests := []struct {
+		name   string
+		code   string
+		last   int64
+		wantOK bool
+	}{
+		{"first use", current, 0, true},
+		{"same code again", current, step, false},
+		{"older code after newer one", previous, step, false},
+		{"older code before newer one", previous, step - 2, true},
+		{"code from the accepted step", previous, step - 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateAfter(rfcSecret, tt.code, now, tt.last); ok != tt.wantOK {
+				t.Errorf("ValidateAfter with last %d = %v, want %v", tt.last, ok, tt.wantOK)
+			}
+		})
+	}
+}
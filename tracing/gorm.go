@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	spanKey   = "tracing:span"
+	parentKey = "tracing:parent"
+)
+
+// GormPlugin records a span for each query run with a traced context, i.e.
+// one given with db.WithContext(c.Request.Context()). Queries without one,
+// such as the background pollers, are skipped rather than each starting a
+// trace of their own. Only the SQL with placeholders is recorded, never the
+// bound values.
+type GormPlugin struct{}
+
+func (GormPlugin) Name() string {
+	return "tracing"
+}
+
+func (p GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		op     string
+		before func(string, func(*gorm.DB)) error
+		after  func(string, func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+	for _, h := range hooks {
+		if err := h.before("tracing:before_"+h.op, startSpan("gorm."+h.op)); err != nil {
+			return err
+		}
+		if err := h.after("tracing:after_"+h.op, endSpan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startSpan(name string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Statement.Context == nil || !trace.SpanContextFromContext(db.Statement.Context).IsValid() {
+			return
+		}
+		ctx, span := Tracer().Start(db.Statement.Context, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemPostgreSQL),
+		)
+		db.InstanceSet(parentKey, db.Statement.Context)
+		db.InstanceSet(spanKey, span)
+		db.Statement.Context = ctx
+	}
+}
+
+func endSpan(db *gorm.DB) {
+	v, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := v.(trace.Span)
+	defer span.End()
+	// Put the caller's context back so a reused chain does not nest its next
+	// query under this one
+	if parent, ok := db.InstanceGet(parentKey); ok {
+		db.Statement.Context = parent.(context.Context)
+	}
+
+	if db.Statement.Table != "" {
+		span.SetAttributes(semconv.DBCollectionName(db.Statement.Table))
+	}
+	span.SetAttributes(
+		semconv.DBQueryText(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
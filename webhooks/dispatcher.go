@@ -0,0 +1,246 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"guidance/events"
+	"guidance/models"
+	"guidance/tracing"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxAttempts     = 8
+	batchSize       = 20
+	baseBackoff     = 30 * time.Second
+	deliveryTimeout = 10 * time.Second
+	// claimLease keeps a claimed batch away from other replicas while it is
+	// being sent. It covers every request in a batch timing out; if the worker
+	// dies the deliveries become due again once it expires.
+	claimLease = batchSize*deliveryTimeout + time.Minute
+)
+
+// Dispatcher turns bus events into persisted deliveries and runs the worker
+// that POSTs them to subscribers.
+type Dispatcher struct {
+	db       *gorm.DB
+	client   *http.Client
+	interval time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewDispatcher(db *gorm.DB) *Dispatcher {
+	return &Dispatcher{
+		db:       db,
+		client:   newClient(deliveryTimeout),
+		interval: 5 * time.Second,
+	}
+}
+
+// Enqueue records a pending delivery of e for every active subscription that
+// listens to its type. It is meant to be subscribed to the event bus.
+func (d *Dispatcher) Enqueue(e events.Event) {
+	var subs []models.WebhookSubscription
+	if err := d.db.Where("active = ?", true).Find(&subs).Error; err != nil {
+		slog.Error("webhooks: failed to load subscriptions", "event", e.Type, "error", err)
+		return
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("webhooks: failed to encode event", "event", e.Type, "error", err)
+		return
+	}
+
+	for _, sub := range subs {
+		if !Matches(sub.Events, e.Type) {
+			continue
+		}
+		delivery := models.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventID:        e.ID,
+			EventType:      e.Type,
+			Payload:        string(payload),
+			Status:         models.DeliveryPending,
+			NextAttemptAt:  time.Now(),
+		}
+		if err := d.db.Create(&delivery).Error; err != nil {
+			slog.Error("webhooks: failed to queue delivery", "event", e.Type, "subscription_id", sub.ID, "error", err)
+		}
+	}
+}
+
+// Matches reports whether a comma separated subscription filter includes
+// eventType.
+func Matches(filter, eventType string) bool {
+	for _, f := range strings.Split(filter, ",") {
+		f = strings.TrimSpace(f)
+		if f == "*" || f == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Start launches the delivery worker in the background.
+func (d *Dispatcher) Start() {
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			d.flush()
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop signals the worker to exit and waits for the current batch.
+func (d *Dispatcher) Stop() {
+	if d.stop == nil {
+		return
+	}
+	close(d.stop)
+	<-d.done
+}
+
+// flush sends one batch of due deliveries. The batch is claimed in a short
+// transaction, with SKIP LOCKED so replicas do not pick the same rows, and
+// the requests are made after it commits so a slow subscriber never holds
+// row locks or a database connection.
+func (d *Dispatcher) flush() {
+	batch, err := d.claim()
+	if err != nil {
+		slog.Error("webhooks: failed to claim deliveries", "error", err)
+		return
+	}
+
+	for i := range batch {
+		d.deliver(&batch[i])
+	}
+}
+
+// deliver makes one attempt at delivery and records the outcome. Each
+// attempt is traced on its own, and the trace is passed on to the subscriber.
+func (d *Dispatcher) deliver(delivery *models.WebhookDelivery) {
+	ctx, span := tracing.Tracer().Start(context.Background(), "webhooks.deliver",
+		trace.WithAttributes(attribute.String("webhook.event", delivery.EventType)))
+	defer span.End()
+	db := d.db.WithContext(ctx)
+
+	var sub models.WebhookSubscription
+	if err := db.First(&sub, delivery.SubscriptionID).Error; err != nil || !sub.Active {
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = "subscription removed or inactive"
+	} else {
+		d.attempt(ctx, sub, delivery)
+	}
+	if delivery.LastError != "" {
+		span.SetStatus(codes.Error, delivery.LastError)
+	}
+	if err := db.Save(delivery).Error; err != nil {
+		slog.Error("webhooks: failed to record delivery", "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+// claim picks the due deliveries and pushes their next attempt past the
+// lease, which is what keeps other workers off them.
+func (d *Dispatcher) claim() ([]models.WebhookDelivery, error) {
+	var batch []models.WebhookDelivery
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now()).
+			Order("id").Limit(batchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(batch))
+		for i, delivery := range batch {
+			ids[i] = delivery.ID
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).
+			Update("next_attempt_at", time.Now().Add(claimLease)).Error
+	})
+	return batch, err
+}
+
+// attempt POSTs the delivery once and updates its state. Failed attempts are
+// retried with exponential backoff until maxAttempts is reached.
+func (d *Dispatcher) attempt(ctx context.Context, sub models.WebhookSubscription, delivery *models.WebhookDelivery) {
+	delivery.Attempts++
+
+	status, err := d.post(ctx, sub, delivery)
+	delivery.ResponseStatus = status
+	if err == nil {
+		now := time.Now()
+		delivery.Status = models.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= maxAttempts {
+		delivery.Status = models.DeliveryFailed
+		return
+	}
+	delivery.NextAttemptAt = time.Now().Add(baseBackoff << (delivery.Attempts - 1))
+}
+
+func (d *Dispatcher) post(ctx context.Context, sub models.WebhookSubscription, delivery *models.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Id", delivery.EventID)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(sub.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("subscriber returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "timestamp.payload" keyed by secret.
+// Receivers recompute it to verify a delivery and reject stale timestamps.
+func Sign(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
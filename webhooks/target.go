@@ -0,0 +1,80 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"guidance/tracing"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var errBlockedTarget = errors.New("webhook URL must not point at a private, loopback or link-local address")
+
+// sharedAddressSpace is the carrier-grade NAT range, which is not public
+// either although net.IP.IsPrivate does not include it.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip)
+}
+
+// CheckTarget validates a subscriber URL: it must be an absolute http(s) URL
+// whose host resolves only to public addresses, so subscriptions cannot be
+// used to reach services inside the network.
+func CheckTarget(ctx context.Context, raw string) error {
+	target, err := url.Parse(raw)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Hostname() == "" {
+		return errors.New("url must be an absolute http(s) URL")
+	}
+	host := target.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if blockedIP(ip) {
+			return errBlockedTarget
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if blockedIP(addr.IP) {
+			return errBlockedTarget
+		}
+	}
+	return nil
+}
+
+// newClient returns the HTTP client deliveries are sent with. It checks the
+// address at connect time as well, so a host that resolves differently later
+// or a redirect to an internal address is refused too.
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+				return errBlockedTarget
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialled instead of the subscriber and defeat the check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: tracing.Transport(transport)}
+}